@@ -5,26 +5,60 @@ import (
 	"github.com/gin-gonic/gin"
 	bHttp "go.dfds.cloud/bootstrap/http"
 	"go.dfds.cloud/bootstrap/log"
+	"go.dfds.cloud/bootstrap/tracing"
 	"go.dfds.cloud/orchestrator"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 type Manager struct {
-	Logger       *zap.Logger
-	HttpRouter   *gin.Engine
-	HttpServer   *http.Server
-	Orchestrator *orchestrator.Orchestrator
-	Context      context.Context
-	CancelFunc   context.CancelFunc
+	Logger         *zap.Logger
+	HttpRouter     *gin.Engine
+	HttpServer     *http.Server
+	Orchestrator   *orchestrator.Orchestrator
+	TracerProvider *sdktrace.TracerProvider
+	Context        context.Context
+	CancelFunc     context.CancelFunc
+	// Wg tracks the running orchestrator jobs, which Stop waits for.
+	Wg *sync.WaitGroup
 }
 
+// shutdownTimeout is how long Stop waits for running jobs to finish.
+const shutdownTimeout = 30 * time.Second
+
+// Stop cancels the context of the Manager and waits for running jobs to finish, before flushing their traces.
 func (m *Manager) Stop() {
 	m.CancelFunc()
+
+	if m.Wg != nil {
+		done := make(chan struct{})
+		go func() {
+			m.Wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			if m.Logger != nil {
+				m.Logger.Warn("Timed out waiting for running jobs to finish")
+			}
+		}
+	}
+
+	if m.TracerProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.TracerProvider.Shutdown(ctx); err != nil && m.Logger != nil {
+			m.Logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}
 }
 
 type ManagerBuilder struct {
@@ -42,7 +76,14 @@ type ManagerBuilder struct {
 	}
 	enableOrchestrator  bool
 	orchestratorOptions struct {
-		namespace string
+		namespace   string
+		adminPrefix string
+		adminAuth   gin.HandlerFunc
+	}
+	enableTracing  bool
+	tracingOptions struct {
+		serviceName string
+		exporter    sdktrace.SpanExporter
 	}
 }
 
@@ -74,6 +115,24 @@ func (m *ManagerBuilder) EnableOrchestrator(namespace string) *ManagerBuilder {
 	return m
 }
 
+// EnableOrchestratorAdmin exposes admin endpoints for the orchestrator jobs under prefix on the HTTP router.
+// The HTTP router is public, so auth has to authorise requests, aborting the ones that aren't. Without auth
+// only the read-only endpoints are exposed. Requires both EnableHttpRouter and EnableOrchestrator.
+func (m *ManagerBuilder) EnableOrchestratorAdmin(prefix string, auth gin.HandlerFunc) *ManagerBuilder {
+	m.orchestratorOptions.adminPrefix = prefix
+	m.orchestratorOptions.adminAuth = auth
+	return m
+}
+
+// EnableTracing sets up OpenTelemetry tracing. If exporter is nil, spans are exported with OTLP over HTTP,
+// configured through the standard OTEL_EXPORTER_OTLP_* environment variables.
+func (m *ManagerBuilder) EnableTracing(serviceName string, exporter sdktrace.SpanExporter) *ManagerBuilder {
+	m.enableTracing = true
+	m.tracingOptions.serviceName = serviceName
+	m.tracingOptions.exporter = exporter
+	return m
+}
+
 func (m *ManagerBuilder) Build() *Manager {
 	manager := &Manager{}
 
@@ -89,6 +148,14 @@ func (m *ManagerBuilder) Build() *Manager {
 		manager.Logger = log.Logger
 	}
 
+	if m.enableTracing {
+		err := tracing.InitializeTracing(m.context, m.tracingOptions.serviceName, m.tracingOptions.exporter)
+		if err != nil {
+			panic(err) // ideally this should never happen
+		}
+		manager.TracerProvider = tracing.TracerProvider
+	}
+
 	if m.enableHttpRouter {
 		router, server := bHttp.NewHttpServer(m.httpRouterOptions.enableDebug)
 		manager.HttpRouter = router
@@ -103,6 +170,11 @@ func (m *ManagerBuilder) Build() *Manager {
 		wg := &sync.WaitGroup{}
 		orc := orchestrator.NewOrchestrator(m.context, wg, m.orchestratorOptions.namespace)
 		manager.Orchestrator = orc
+		manager.Wg = wg
+
+		if m.orchestratorOptions.adminPrefix != "" && manager.HttpRouter != nil {
+			bHttp.RegisterOrchestratorRoutes(manager.HttpRouter.Group(m.orchestratorOptions.adminPrefix), orc, m.orchestratorOptions.adminAuth)
+		}
 	}
 
 	return manager
@@ -0,0 +1,53 @@
+package bootstrap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// recordingExporter records the exported spans, which unlike tracetest.InMemoryExporter it keeps on Shutdown.
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestManager_StopWaitsForJobs(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := &Manager{
+		TracerProvider: provider,
+		Context:        ctx,
+		CancelFunc:     cancel,
+		Wg:             &sync.WaitGroup{},
+	}
+
+	// A job ending its span while shutting down
+	manager.Wg.Add(1)
+	go func() {
+		defer manager.Wg.Done()
+		_, span := provider.Tracer("test").Start(context.Background(), "job")
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		span.End()
+	}()
+
+	manager.Stop()
+	assert.Len(t, exporter.spans, 1)
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.dfds.cloud/orchestrator"
+)
+
+type jobResponse struct {
+	Name       string   `json:"name"`
+	Tags       []string `json:"tags"`
+	Enabled    bool     `json:"enabled"`
+	Paused     bool     `json:"paused"`
+	InProgress bool     `json:"inProgress"`
+	Interval   string   `json:"interval"`
+	Cron       string   `json:"cron,omitempty"`
+}
+
+type groupResponse struct {
+	Tag  string   `json:"tag"`
+	Jobs []string `json:"jobs"`
+}
+
+// RegisterOrchestratorRoutes adds admin endpoints for listing, pausing, resuming and triggering orchestrator jobs,
+// individually or grouped by tag. All endpoints are guarded by auth, which should abort unauthorised requests.
+// Without auth only the read-only endpoints are added.
+func RegisterOrchestratorRoutes(router gin.IRouter, orc *orchestrator.Orchestrator, auth gin.HandlerFunc) {
+	if auth != nil {
+		router = router.Group("", auth)
+	}
+
+	router.GET("/jobs", listJobsHandler(orc))
+	router.GET("/tags/:tag/jobs", listJobsHandler(orc))
+	if auth == nil {
+		return
+	}
+
+	router.POST("/jobs/:name/pause", jobHandler(orc.PauseJob))
+	router.POST("/jobs/:name/resume", jobHandler(orc.ResumeJob))
+	router.POST("/jobs/:name/trigger", jobHandler(orc.TriggerJob))
+	router.POST("/tags/:tag/pause", tagHandler(orc.PauseTag))
+	router.POST("/tags/:tag/resume", tagHandler(orc.ResumeTag))
+	router.POST("/tags/:tag/trigger", tagHandler(orc.TriggerTag))
+}
+
+func listJobsHandler(orc *orchestrator.Orchestrator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tag := c.Param("tag")
+		if tag == "" {
+			tag = c.Query("tag")
+		}
+
+		jobs := []jobResponse{}
+		for _, job := range orc.JobsByTag(tag) {
+			jobs = append(jobs, jobResponse{
+				Name:       job.Name,
+				Tags:       job.Tags,
+				Enabled:    job.Schedule.Enabled(),
+				Paused:     job.Paused(),
+				InProgress: job.Status.InProgress(),
+				Interval:   job.Schedule.Interval().String(),
+				Cron:       job.Schedule.Cron(),
+			})
+		}
+
+		c.JSON(http.StatusOK, jobs)
+	}
+}
+
+func jobHandler(f func(name string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := f(c.Param("name"))
+		if errors.Is(err, orchestrator.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if errors.Is(err, orchestrator.ErrJobPaused) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func tagHandler(f func(tag string) []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tag := c.Param("tag")
+		c.JSON(http.StatusOK, groupResponse{
+			Tag:  tag,
+			Jobs: f(tag),
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/orchestrator"
+)
+
+const testToken = "Bearer admin"
+
+func newTestAdmin(t *testing.T, namespace string, auth gin.HandlerFunc) (*gin.Engine, *orchestrator.Orchestrator, *sync.WaitGroup) {
+	gin.SetMode(gin.TestMode)
+	wg := &sync.WaitGroup{}
+	orc := orchestrator.NewOrchestrator(context.Background(), wg, namespace)
+	noop := func(ctx context.Context) error { return nil }
+	assert.NoError(t, orc.AddJobE("TESTADMIN", orchestrator.NewJob("ec2", noop).WithTags("aws"), &orchestrator.Schedule{}))
+	assert.NoError(t, orc.AddJobE("TESTADMIN", orchestrator.NewJob("s3", noop).WithTags("aws"), &orchestrator.Schedule{}))
+	assert.NoError(t, orc.AddJobE("TESTADMIN", orchestrator.NewJob("report", noop), &orchestrator.Schedule{}))
+
+	router := gin.New()
+	RegisterOrchestratorRoutes(router.Group("/admin"), orc, auth)
+	return router, orc, wg
+}
+
+func tokenAuth(c *gin.Context) {
+	if c.GetHeader("Authorization") != testToken {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+func request(router http.Handler, method string, path string, authorised bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if authorised {
+		req.Header.Set("Authorization", testToken)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestOrchestratorRoutes_UnknownJob(t *testing.T) {
+	router, _, _ := newTestAdmin(t, "test_admin_unknown_job", tokenAuth)
+
+	for _, action := range []string{"pause", "resume", "trigger"} {
+		resp := request(router, http.MethodPost, "/admin/jobs/missing/"+action, true)
+		assert.Equal(t, http.StatusNotFound, resp.Code, action)
+	}
+}
+
+func TestOrchestratorRoutes_TagFanOut(t *testing.T) {
+	router, orc, wg := newTestAdmin(t, "test_admin_tag_fan_out", tokenAuth)
+
+	resp := request(router, http.MethodPost, "/admin/tags/aws/pause", true)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var group groupResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &group))
+	assert.Equal(t, groupResponse{Tag: "aws", Jobs: []string{"ec2", "s3"}}, group)
+	assert.True(t, orc.Jobs["ec2"].Paused())
+	assert.True(t, orc.Jobs["s3"].Paused())
+	assert.False(t, orc.Jobs["report"].Paused())
+
+	// Paused jobs are skipped when triggered, whether by tag or by name
+	assert.NoError(t, orc.ResumeJob("ec2"))
+	resp = request(router, http.MethodPost, "/admin/tags/aws/trigger", true)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &group))
+	assert.Equal(t, []string{"ec2"}, group.Jobs)
+	wg.Wait()
+
+	resp = request(router, http.MethodPost, "/admin/jobs/s3/trigger", true)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	resp = request(router, http.MethodGet, "/admin/tags/aws/jobs", true)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var jobs []jobResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 2)
+}
+
+func TestOrchestratorRoutes_Auth(t *testing.T) {
+	router, orc, _ := newTestAdmin(t, "test_admin_auth", tokenAuth)
+
+	resp := request(router, http.MethodPost, "/admin/jobs/report/pause", false)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.False(t, orc.Jobs["report"].Paused())
+
+	resp = request(router, http.MethodGet, "/admin/jobs", false)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = request(router, http.MethodPost, "/admin/jobs/report/pause", true)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.True(t, orc.Jobs["report"].Paused())
+}
+
+func TestOrchestratorRoutes_WithoutAuth(t *testing.T) {
+	router, orc, _ := newTestAdmin(t, "test_admin_without_auth", nil)
+
+	resp := request(router, http.MethodGet, "/admin/jobs", false)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = request(router, http.MethodPost, "/admin/jobs/report/pause", false)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.False(t, orc.Jobs["report"].Paused())
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var TracerProvider *sdktrace.TracerProvider
+
+// InitializeTracing sets up the global TracerProvider and propagator. If exporter is nil, spans are exported
+// with OTLP over HTTP, configured through the standard OTEL_EXPORTER_OTLP_* environment variables.
+// Use tracetest.NewInMemoryExporter() as exporter in tests.
+func InitializeTracing(ctx context.Context, serviceName string, exporter sdktrace.SpanExporter) error {
+	if exporter == nil {
+		otlpExporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return err
+		}
+		exporter = otlpExporter
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return err
+	}
+
+	TracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(TracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers collector with registerer. If an equal collector is already registered, that one is returned
+// instead, so collectors can be shared by everything registering them with the same registerer and namespace.
+func Register[T prometheus.Collector](registerer prometheus.Registerer, collector T) T {
+	err := registerer.Register(collector)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return alreadyRegistered.ExistingCollector.(T)
+	} else if err != nil {
+		panic(err) // ideally this should never happen
+	}
+	return collector
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	registerer := prometheus.NewRegistry()
+	opts := prometheus.CounterOpts{Name: "events_handled_total", Namespace: "test"}
+
+	counter := Register(registerer, prometheus.NewCounter(opts))
+	assert.Same(t, counter, Register(registerer, prometheus.NewCounter(opts)))
+
+	assert.Panics(t, func() {
+		Register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{Name: "events_handled_total", Namespace: "test", Help: "Other help"}))
+	})
+}
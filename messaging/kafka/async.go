@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging/internal/metrics"
+)
+
+// DeliveryCallback is called once a message published asynchronously has been delivered, or failed to be.
+// It is called from goroutines of the publisher, and should return quickly.
+type DeliveryCallback func(delivery Delivery, err error)
+
+// DeliveryReport is the outcome of publishing a message asynchronously, as sent by ReportTo.
+type DeliveryReport struct {
+	Delivery Delivery
+	Err      error
+}
+
+// ReportTo returns a DeliveryCallback sending delivery reports to reports. The channel must be drained, since
+// sending blocks the publisher.
+func ReportTo(reports chan<- DeliveryReport) DeliveryCallback {
+	return func(delivery Delivery, err error) {
+		reports <- DeliveryReport{Delivery: delivery, Err: err}
+	}
+}
+
+// PublishAsync queues msg for publishing to topic without waiting for it to be delivered, and calls callback once
+// it has been. If MaxInFlight messages are awaiting delivery, PublishAsync blocks until one of them is delivered
+// or ctx is done. msg gets a HeaderMessageId header if it doesn't have one, which the delivery reports are matched on,
+// and is correlated like messages published with PublishContext.
+func (p *Publisher) PublishAsync(ctx context.Context, topic string, msg kafka.Message, callback DeliveryCallback) error {
+	writer, err := p.asyncWriter(topic)
+	if err != nil {
+		return err
+	}
+
+	messageId := headerValue(msg.Headers, HeaderMessageId)
+	if messageId == "" {
+		messageId = newMessageId()
+		msg.Headers = append(append(make([]kafka.Header, 0, len(msg.Headers)+1), msg.Headers...), kafka.Header{Key: HeaderMessageId, Value: []byte(messageId)})
+	}
+	if headerValue(msg.Headers, HeaderCorrelationId) == "" {
+		msg.Headers = append(append(make([]kafka.Header, 0, len(msg.Headers)+1), msg.Headers...), kafka.Header{Key: HeaderCorrelationId, Value: []byte(correlationIdFromContextOrNew(ctx))})
+	}
+
+	p.mu.Lock()
+	inFlight := p.inFlight
+	m := p.metrics
+	p.mu.Unlock()
+
+	select {
+	case inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	_, awaiting := p.deliveries.LoadOrStore(messageId, DeliveryCallback(func(delivery Delivery, err error) {
+		<-inFlight
+		m.setInFlight(len(inFlight))
+		if callback != nil {
+			callback(delivery, err)
+		}
+	}))
+	if awaiting {
+		<-inFlight
+		return errAwaitingDelivery(messageId)
+	}
+	m.setInFlight(len(inFlight))
+
+	err = writer.WriteMessages(ctx, msg)
+	if err != nil {
+		if _, exists := p.deliveries.LoadAndDelete(messageId); exists {
+			<-inFlight
+			m.setInFlight(len(inFlight))
+		}
+		m.observe(topic, err)
+		return err
+	}
+
+	return nil
+}
+
+// PublishEventAsync is the asynchronous variant of PublishEvent. See PublishAsync.
+func PublishEventAsync[T any](ctx context.Context, p *Publisher, topic string, key string, eventName string, version string, payload T, callback DeliveryCallback, opts ...PublishOption) error {
+	msg, err := p.eventMessage(ctx, key, eventName, version, payload, opts)
+	if err != nil {
+		return err
+	}
+
+	return p.PublishAsync(ctx, topic, msg, callback)
+}
+
+type publisherMetrics struct {
+	published *prometheus.CounterVec
+	inFlight  prometheus.Gauge
+}
+
+// EnableMetrics makes the publisher record how many messages are published and fail to be, by topic, and how many
+// messages published asynchronously await delivery. It should be called before publishing.
+func (p *Publisher) EnableMetrics(registerer prometheus.Registerer, namespace string) {
+	m := &publisherMetrics{
+		published: metrics.Register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "kafka_messages_published_total",
+			Help:      "How many messages have been published to {topic}, by {outcome}.",
+			Namespace: namespace,
+		}, []string{"topic", "outcome"})),
+		inFlight: metrics.Register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:      "kafka_messages_in_flight",
+			Help:      "How many messages published asynchronously await delivery.",
+			Namespace: namespace,
+		})),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metrics = m
+}
+
+// metricsOf returns the metrics of p, nil if they aren't enabled.
+func (p *Publisher) metricsOf() *publisherMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.metrics
+}
+
+func errAwaitingDelivery(messageId string) error {
+	return errors.New("a message with messageId " + messageId + " is already awaiting delivery")
+}
+
+func (m *publisherMetrics) observe(topic string, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	m.published.WithLabelValues(topic, outcome).Inc()
+}
+
+func (m *publisherMetrics) setInFlight(count int) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Set(float64(count))
+}
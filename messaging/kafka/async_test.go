@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPublisher_PublishAsyncBackpressure(t *testing.T) {
+	p := NewPublisher(AuthConfig{Brokers: []string{"localhost:9092"}}, nil, zap.NewNop(), context.Background())
+	config := DefaultPublisherConfig()
+	config.MaxInFlight = 1
+	p.SetConfig(config)
+	defer p.Close()
+
+	// Occupy the only slot, as if a message was awaiting delivery
+	p.inFlight <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := p.PublishAsync(ctx, "topic", kafka.Message{Value: []byte("{}")}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPublisher_DeliveryReports(t *testing.T) {
+	p := NewPublisher(AuthConfig{}, nil, zap.NewNop(), context.Background())
+	registerer := prometheus.NewRegistry()
+	p.EnableMetrics(registerer, "test")
+
+	reports := make(chan DeliveryReport, 2)
+	callback := ReportTo(reports)
+	p.deliveries.Store("message-1", callback)
+	p.deliveries.Store("message-2", callback)
+
+	p.completion([]kafka.Message{{Topic: "topic", Offset: 1, Headers: []kafka.Header{{Key: HeaderMessageId, Value: []byte("message-1")}}}}, nil)
+	p.completion([]kafka.Message{{Topic: "topic", Headers: []kafka.Header{{Key: HeaderMessageId, Value: []byte("message-2")}}}}, errors.New("broker unavailable"))
+
+	report := <-reports
+	assert.NoError(t, report.Err)
+	assert.Equal(t, "message-1", report.Delivery.MessageId)
+	assert.Equal(t, int64(1), report.Delivery.Offset)
+	report = <-reports
+	assert.Error(t, report.Err)
+	assert.Equal(t, "message-2", report.Delivery.MessageId)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.published.WithLabelValues("topic", "success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.published.WithLabelValues("topic", "failure")))
+}
+
+func TestPublisher_PublishAsyncDuplicateMessageId(t *testing.T) {
+	p := NewPublisherWithBroker(newTestBroker(), AuthConfig{}, nil, zap.NewNop(), context.Background())
+	p.deliveries.Store("message-1", DeliveryCallback(func(delivery Delivery, err error) {}))
+
+	msg := kafka.Message{Value: []byte("{}"), Headers: []kafka.Header{{Key: HeaderMessageId, Value: []byte("message-1")}}}
+	assert.Error(t, p.PublishAsync(context.Background(), "topic", msg, nil))
+	assert.Empty(t, p.inFlight)
+}
+
+func TestPublisher_EnableMetricsWhilePublishing(t *testing.T) {
+	broker := newTestBroker()
+	p := NewPublisherWithBroker(broker, AuthConfig{}, nil, zap.NewNop(), context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, p.PublishAsync(context.Background(), "topic", kafka.Message{Value: []byte("{}")}, nil))
+		}
+	}()
+	p.EnableMetrics(prometheus.NewRegistry(), "test")
+	<-done
+
+	assert.Len(t, broker.Written("topic"), 100)
+	assert.Empty(t, p.inFlight)
+}
@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageReader fetches messages for a Consumer. It is implemented by kafka.Reader.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// MessageWriter writes messages for a Publisher. It is implemented by kafka.Writer.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Broker creates the readers and writers consumers and publishers talk to the brokers through, so they can be
+// replaced, e.g. by the in-memory broker of the memory package in tests.
+type Broker interface {
+	NewReader(config kafka.ReaderConfig) MessageReader
+	// NewWriter creates a writer configured like writer. kafka-go configures writers through their fields, so
+	// writer holds the configuration, e.g. Topic, Async and Completion.
+	NewWriter(writer *kafka.Writer) MessageWriter
+}
+
+// kafkaBroker is the Broker talking to an actual Kafka cluster.
+type kafkaBroker struct{}
+
+// NewKafkaBroker returns the Broker talking to an actual Kafka cluster through kafka-go.
+func NewKafkaBroker() Broker {
+	return kafkaBroker{}
+}
+
+func (kafkaBroker) NewReader(config kafka.ReaderConfig) MessageReader {
+	return kafka.NewReader(config)
+}
+
+func (kafkaBroker) NewWriter(writer *kafka.Writer) MessageWriter {
+	return writer
+}
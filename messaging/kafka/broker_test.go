@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// testBroker is a Broker for tests. Readers hand out the messages sent to them through their messages channel,
+// while writes are recorded per topic, or fail with writeErr if set.
+type testBroker struct {
+	mu       sync.Mutex
+	readers  map[string]*testReader
+	written  map[string][]kafka.Message
+	writeErr error
+}
+
+func newTestBroker() *testBroker {
+	return &testBroker{
+		readers: map[string]*testReader{},
+		written: map[string][]kafka.Message{},
+	}
+}
+
+func (b *testBroker) NewReader(config kafka.ReaderConfig) MessageReader {
+	return b.reader(config.Topic)
+}
+
+// reader returns the reader of topic, all consumers of a topic sharing the same reader.
+func (b *testBroker) reader(topic string) *testReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reader, exists := b.readers[topic]
+	if !exists {
+		reader = &testReader{messages: make(chan kafka.Message, 100), closed: make(chan struct{})}
+		b.readers[topic] = reader
+	}
+	return reader
+}
+
+func (b *testBroker) NewWriter(writer *kafka.Writer) MessageWriter {
+	return &testWriter{broker: b, topic: writer.Topic, completion: writer.Completion}
+}
+
+// Written returns the messages written to topic.
+func (b *testBroker) Written(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kafka.Message(nil), b.written[topic]...)
+}
+
+type testReader struct {
+	messages  chan kafka.Message
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mu        sync.Mutex
+	commits   [][]kafka.Message
+	commitErr error
+	// onCommit is called with the messages of each commit, before they are recorded
+	onCommit func(msgs []kafka.Message)
+}
+
+func (r *testReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case <-r.closed:
+		return kafka.Message{}, io.EOF
+	default:
+	}
+
+	select {
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	case <-r.closed:
+		return kafka.Message{}, io.EOF
+	case msg := <-r.messages:
+		return msg, nil
+	}
+}
+
+func (r *testReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.commitErr != nil {
+		return r.commitErr
+	}
+	if r.onCommit != nil {
+		r.onCommit(msgs)
+	}
+	r.commits = append(r.commits, msgs)
+	return nil
+}
+
+func (r *testReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+// Commits returns the messages passed to each call of CommitMessages.
+func (r *testReader) Commits() [][]kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]kafka.Message(nil), r.commits...)
+}
+
+// Committed returns the next offset to consume of partition according to the commits, or -1 if nothing has
+// been committed.
+func (r *testReader) Committed(partition int) int64 {
+	offset := int64(-1)
+	for _, commit := range r.Commits() {
+		for _, msg := range commit {
+			if msg.Partition == partition && msg.Offset+1 > offset {
+				offset = msg.Offset + 1
+			}
+		}
+	}
+	return offset
+}
+
+type testWriter struct {
+	broker     *testBroker
+	topic      string
+	completion func(messages []kafka.Message, err error)
+}
+
+func (w *testWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	written := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		msg.Topic = w.topic
+		written[i] = msg
+	}
+
+	w.broker.mu.Lock()
+	err := w.broker.writeErr
+	if err == nil {
+		w.broker.written[w.topic] = append(w.broker.written[w.topic], written...)
+	}
+	w.broker.mu.Unlock()
+
+	if w.completion != nil {
+		w.completion(written, err)
+	}
+	return err
+}
+
+func (w *testWriter) Close() error {
+	return nil
+}
+
+// newTestConsumer creates a Consumer of topic on broker, which is stopped when the test finishes.
+func newTestConsumer(t *testing.T, broker *testBroker, topic string) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	consumer := NewConsumerWithBroker(broker, topic, "test", AuthConfig{}, nil, zap.NewNop(), wg, ctx)
+	consumer.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	return consumer
+}
+
+func TestNewConsumerWithBroker_Reader(t *testing.T) {
+	consumer := NewConsumer(testTopic, "test", AuthConfig{Brokers: []string{"localhost:9092"}}, nil, zap.NewNop(), &sync.WaitGroup{}, context.Background())
+	assert.NotNil(t, consumer.Reader)
+	assert.Same(t, consumer.Reader, consumer.reader)
+	assert.NoError(t, consumer.Reader.Close())
+
+	broker := newTestBroker()
+	consumer = newTestConsumer(t, broker, testTopic)
+	assert.Nil(t, consumer.Reader)
+	assert.Same(t, broker.reader(testTopic), consumer.reader)
+}
@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// CommitConfig decides how often the offsets of processed messages are committed. Offsets are committed once
+// Count messages have been processed or Interval has passed since the last commit, whichever comes first.
+// Anything left is committed when the consumer stops.
+type CommitConfig struct {
+	Count    int           `envconfig:"COUNT" default:"100"`
+	Interval time.Duration `envconfig:"INTERVAL" default:"5s"`
+}
+
+func DefaultCommitConfig() CommitConfig {
+	return CommitConfig{
+		Count:    100,
+		Interval: 5 * time.Second,
+	}
+}
+
+// SetCommitConfig sets how often offsets are committed.
+func (c *Consumer) SetCommitConfig(config CommitConfig) {
+	c.commitConfig = config
+}
+
+// offsetCommitter batches offset commits, committing through the consumer group session of the reader.
+type offsetCommitter struct {
+	mu         sync.Mutex
+	reader     MessageReader
+	config     CommitConfig
+	logger     *zap.Logger
+	pending    map[int]kafka.Message
+	count      int
+	lastCommit time.Time
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+func newOffsetCommitter(reader MessageReader, config CommitConfig, logger *zap.Logger) *offsetCommitter {
+	return &offsetCommitter{
+		reader:     reader,
+		config:     config,
+		logger:     logger,
+		pending:    map[int]kafka.Message{},
+		lastCommit: time.Now(),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Start commits pending offsets every Interval, so offsets are committed while no messages are coming in.
+func (o *offsetCommitter) Start(ctx context.Context) {
+	go func() {
+		defer close(o.stopped)
+		if o.config.Interval <= 0 {
+			<-o.done
+			return
+		}
+
+		ticker := time.NewTicker(o.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-o.done:
+				return
+			case <-ticker.C:
+				o.commitIfDue(ctx)
+			}
+		}
+	}()
+}
+
+// MarkProcessed records msg as processed, committing if a threshold has been reached.
+// Messages of a partition must be marked in order.
+func (o *offsetCommitter) MarkProcessed(ctx context.Context, msg kafka.Message) {
+	o.record(msg, 1)
+	o.commitIfDue(ctx)
+}
+
+// record records msg as the last processed message of its partition, with processed being the number of
+// messages processed since the previous record.
+func (o *offsetCommitter) record(msg kafka.Message, processed int) {
+	o.mu.Lock()
+	o.pending[msg.Partition] = msg
+	o.count += processed
+	o.mu.Unlock()
+}
+
+func (o *offsetCommitter) commitIfDue(ctx context.Context) {
+	o.mu.Lock()
+	due := o.count > 0 && ((o.config.Count > 0 && o.count >= o.config.Count) || time.Since(o.lastCommit) >= o.config.Interval)
+	o.mu.Unlock()
+
+	if due {
+		if err := o.Commit(ctx); err != nil {
+			o.logger.Error("Unable to commit offsets for consumer group", zap.Error(err))
+		}
+	}
+}
+
+// Commit commits the offsets of all processed messages.
+func (o *offsetCommitter) Commit(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.pending) == 0 {
+		return nil
+	}
+
+	msgs := make([]kafka.Message, 0, len(o.pending))
+	for _, msg := range o.pending {
+		msgs = append(msgs, msg)
+	}
+
+	err := o.reader.CommitMessages(ctx, msgs...)
+	if err != nil {
+		return err
+	}
+
+	o.logger.Debug("Commit for consumer group updated", zap.Int("messages", o.count))
+	o.pending = map[int]kafka.Message{}
+	o.count = 0
+	o.lastCommit = time.Now()
+
+	return nil
+}
+
+// Stop stops the periodic commits and flushes anything left.
+func (o *offsetCommitter) Stop(ctx context.Context) error {
+	close(o.done)
+	<-o.stopped
+	return o.Commit(ctx)
+}
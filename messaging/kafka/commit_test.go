@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func offsets(commit []kafka.Message) map[int]int64 {
+	result := map[int]int64{}
+	for _, msg := range commit {
+		result[msg.Partition] = msg.Offset
+	}
+	return result
+}
+
+func TestOffsetCommitter_CommitsEveryCount(t *testing.T) {
+	reader := &testReader{}
+	committer := newOffsetCommitter(reader, CommitConfig{Count: 3, Interval: time.Hour}, zap.NewNop())
+	ctx := context.Background()
+
+	committer.MarkProcessed(ctx, kafka.Message{Partition: 0, Offset: 10})
+	committer.MarkProcessed(ctx, kafka.Message{Partition: 1, Offset: 5})
+	assert.Empty(t, reader.Commits())
+
+	// Only the last message of each partition is committed
+	committer.MarkProcessed(ctx, kafka.Message{Partition: 0, Offset: 11})
+	commits := reader.Commits()
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, map[int]int64{0: 11, 1: 5}, offsets(commits[0]))
+	}
+
+	committer.MarkProcessed(ctx, kafka.Message{Partition: 0, Offset: 12})
+	committer.MarkProcessed(ctx, kafka.Message{Partition: 0, Offset: 13})
+	assert.Len(t, reader.Commits(), 1)
+	committer.MarkProcessed(ctx, kafka.Message{Partition: 0, Offset: 14})
+	commits = reader.Commits()
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, map[int]int64{0: 14}, offsets(commits[1]))
+	}
+}
+
+func TestOffsetCommitter_CommitsEveryInterval(t *testing.T) {
+	reader := &testReader{}
+	committer := newOffsetCommitter(reader, CommitConfig{Count: 100, Interval: 20 * time.Millisecond}, zap.NewNop())
+	committer.Start(context.Background())
+	defer committer.Stop(context.Background())
+
+	committer.MarkProcessed(context.Background(), kafka.Message{Partition: 0, Offset: 10})
+	assert.Eventually(t, func() bool {
+		return len(reader.Commits()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, map[int]int64{0: 10}, offsets(reader.Commits()[0]))
+
+	// Nothing is committed while no messages are processed
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, reader.Commits(), 1)
+}
+
+func TestOffsetCommitter_StopFlushes(t *testing.T) {
+	reader := &testReader{}
+	committer := newOffsetCommitter(reader, CommitConfig{Count: 100, Interval: time.Hour}, zap.NewNop())
+	committer.Start(context.Background())
+
+	committer.MarkProcessed(context.Background(), kafka.Message{Partition: 0, Offset: 10})
+	committer.MarkProcessed(context.Background(), kafka.Message{Partition: 2, Offset: 3})
+	assert.Empty(t, reader.Commits())
+
+	assert.NoError(t, committer.Stop(context.Background()))
+	commits := reader.Commits()
+	if assert.Len(t, commits, 1) {
+		assert.Len(t, commits[0], 2)
+		assert.Equal(t, map[int]int64{0: 10, 2: 3}, offsets(commits[0]))
+	}
+}
+
+func TestOffsetCommitter_KeepsOffsetsWhenCommitFails(t *testing.T) {
+	reader := &testReader{commitErr: errors.New("group rebalancing")}
+	committer := newOffsetCommitter(reader, CommitConfig{Count: 1, Interval: time.Hour}, zap.NewNop())
+
+	committer.MarkProcessed(context.Background(), kafka.Message{Partition: 0, Offset: 10})
+	assert.Empty(t, reader.Commits())
+
+	reader.mu.Lock()
+	reader.commitErr = nil
+	reader.mu.Unlock()
+
+	assert.NoError(t, committer.Commit(context.Background()))
+	commits := reader.Commits()
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, map[int]int64{0: 10}, offsets(commits[0]))
+	}
+}
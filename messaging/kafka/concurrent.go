@@ -0,0 +1,202 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap"
+)
+
+// ConcurrencyConfig enables processing messages in parallel. Messages from different partitions are processed
+// in parallel, and with KeyWorkers above 1, so are messages with different keys within a partition. Messages with
+// the same key are always processed in order. Offsets are only committed once all messages before them in the
+// partition have been processed.
+type ConcurrencyConfig struct {
+	Enabled bool `envconfig:"ENABLED" default:"false"`
+	// KeyWorkers is the number of workers per partition. Messages are assigned to a worker based on their key.
+	KeyWorkers int `envconfig:"KEY_WORKERS" default:"1"`
+	// BufferSize is the number of messages queued per worker before fetching is paused. Defaults to 100, as
+	// without a buffer a single slow key would pause fetching for all partitions.
+	BufferSize int `envconfig:"BUFFER_SIZE" default:"100"`
+}
+
+func DefaultConcurrencyConfig() ConcurrencyConfig {
+	return ConcurrencyConfig{
+		Enabled:    false,
+		KeyWorkers: 1,
+		BufferSize: 100,
+	}
+}
+
+// SetConcurrencyConfig sets whether, and how, messages are processed in parallel. Fields that aren't set
+// default to those of DefaultConcurrencyConfig.
+func (c *Consumer) SetConcurrencyConfig(config ConcurrencyConfig) {
+	defaults := DefaultConcurrencyConfig()
+	if config.KeyWorkers <= 0 {
+		config.KeyWorkers = defaults.KeyWorkers
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	c.concurrency = config
+}
+
+type workerKey struct {
+	partition int
+	slot      int
+}
+
+// consumeConcurrently processes messages in parallel until the consumer is stopped. An error is returned if a
+// message couldn't be processed, in which case all workers are stopped.
+func (c *Consumer) consumeConcurrently(committer *offsetCommitter, initialHandlerContext *model.HandlerContext) error {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	var failOnce sync.Once
+	var failure error
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+
+	tracker := newOffsetTracker()
+	workers := map[workerKey]chan kafka.Message{}
+	var wg sync.WaitGroup
+
+	work := func(queue chan kafka.Message) {
+		defer wg.Done()
+		for msg := range queue {
+			if ctx.Err() != nil {
+				// Unprocessed messages aren't committed, so they are redelivered
+				continue
+			}
+
+			if c.retryLevel > 0 && !c.waitUntilDue(ctx, msg) {
+				continue
+			}
+
+			err := c.processMessage(msg, initialHandlerContext)
+			if err != nil {
+				fail(err)
+				continue
+			}
+
+			tracker.Complete(msg, committer)
+			committer.commitIfDue(ctx)
+		}
+	}
+
+	for {
+		msg, err := c.fetchMessage(ctx)
+		if err != nil {
+			break
+		}
+
+		key := workerKey{partition: msg.Partition, slot: c.keySlot(msg.Key)}
+		queue, exists := workers[key]
+		if !exists {
+			queue = make(chan kafka.Message, c.concurrency.BufferSize)
+			workers[key] = queue
+			wg.Add(1)
+			go work(queue)
+		}
+
+		tracker.Add(msg)
+		select {
+		case queue <- msg:
+		case <-ctx.Done():
+		}
+	}
+
+	for _, queue := range workers {
+		close(queue)
+	}
+	wg.Wait()
+
+	if failure != nil {
+		c.logger.Error("Stopped processing messages", zap.Error(failure))
+	}
+
+	return failure
+}
+
+func (c *Consumer) keySlot(key []byte) int {
+	if c.concurrency.KeyWorkers <= 1 || len(key) == 0 {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write(key)
+	return int(hash.Sum32() % uint32(c.concurrency.KeyWorkers))
+}
+
+// offsetTracker keeps track of in-flight messages per partition, so only offsets of contiguous processed
+// messages are committed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	// inFlight is ordered by offset
+	inFlight  []kafka.Message
+	completed map[int64]bool
+	// next is the offset following the last message added
+	next int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: map[int]*partitionOffsets{},
+	}
+}
+
+// Add registers a fetched message. Messages of a partition are fetched in order, unless they are redelivered after
+// a rebalance, in which case tracking of the partition starts over from the redelivered message.
+func (t *offsetTracker) Add(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partition, exists := t.partitions[msg.Partition]
+	if !exists || msg.Offset < partition.next {
+		partition = &partitionOffsets{completed: map[int64]bool{}}
+		t.partitions[msg.Partition] = partition
+	}
+	partition.inFlight = append(partition.inFlight, msg)
+	partition.next = msg.Offset + 1
+}
+
+// Complete marks msg as processed, and hands the last message of the contiguous processed messages in its
+// partition to committer. Messages no longer tracked, as they were fetched before tracking started over, are ignored.
+func (t *offsetTracker) Complete(msg kafka.Message, committer *offsetCommitter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partition, exists := t.partitions[msg.Partition]
+	if !exists {
+		return
+	}
+	i := sort.Search(len(partition.inFlight), func(i int) bool { return partition.inFlight[i].Offset >= msg.Offset })
+	if i == len(partition.inFlight) || partition.inFlight[i].Offset != msg.Offset {
+		return
+	}
+	partition.completed[msg.Offset] = true
+
+	processed := 0
+	var last kafka.Message
+	for len(partition.inFlight) > 0 && partition.completed[partition.inFlight[0].Offset] {
+		last = partition.inFlight[0]
+		delete(partition.completed, last.Offset)
+		partition.inFlight = partition.inFlight[1:]
+		processed++
+	}
+
+	if processed > 0 {
+		committer.record(last, processed)
+	}
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap"
+)
+
+func TestOffsetTracker_Complete(t *testing.T) {
+	committer := newOffsetCommitter(nil, CommitConfig{}, zap.NewNop())
+	tracker := newOffsetTracker()
+
+	msgs := []kafka.Message{
+		{Partition: 0, Offset: 10},
+		{Partition: 0, Offset: 11},
+		{Partition: 0, Offset: 12},
+		{Partition: 1, Offset: 5},
+	}
+	for _, msg := range msgs {
+		tracker.Add(msg)
+	}
+
+	// Out of order completion doesn't move the committed offset past unprocessed messages
+	tracker.Complete(msgs[1], committer)
+	tracker.Complete(msgs[2], committer)
+	assert.Empty(t, committer.pending)
+
+	tracker.Complete(msgs[0], committer)
+	assert.Equal(t, int64(12), committer.pending[0].Offset)
+	assert.Equal(t, 3, committer.count)
+
+	tracker.Complete(msgs[3], committer)
+	assert.Equal(t, int64(5), committer.pending[1].Offset)
+	assert.Equal(t, 4, committer.count)
+}
+
+func TestOffsetTracker_Redelivered(t *testing.T) {
+	committer := newOffsetCommitter(nil, CommitConfig{}, zap.NewNop())
+	tracker := newOffsetTracker()
+
+	for offset := int64(10); offset <= 12; offset++ {
+		tracker.Add(kafka.Message{Offset: offset})
+	}
+	tracker.Complete(kafka.Message{Offset: 11}, committer)
+
+	// After a rebalance, the in-flight messages are redelivered and tracking starts over
+	for offset := int64(10); offset <= 12; offset++ {
+		tracker.Add(kafka.Message{Offset: offset})
+	}
+	tracker.Complete(kafka.Message{Offset: 10}, committer)
+	tracker.Complete(kafka.Message{Offset: 11}, committer)
+	assert.Equal(t, int64(11), committer.pending[0].Offset)
+	assert.Equal(t, 2, committer.count)
+
+	// The frontier keeps moving, whichever copy of a message completes last
+	tracker.Complete(kafka.Message{Offset: 12}, committer)
+	tracker.Complete(kafka.Message{Offset: 12}, committer)
+	tracker.Add(kafka.Message{Offset: 13})
+	tracker.Complete(kafka.Message{Offset: 13}, committer)
+	assert.Equal(t, int64(13), committer.pending[0].Offset)
+	assert.Equal(t, 4, committer.count)
+	assert.Empty(t, tracker.partitions[0].inFlight)
+	assert.Empty(t, tracker.partitions[0].completed)
+}
+
+func TestConsumer_KeySlot(t *testing.T) {
+	c := &Consumer{concurrency: ConcurrencyConfig{Enabled: true, KeyWorkers: 4}}
+
+	assert.Equal(t, c.keySlot([]byte("capability-1")), c.keySlot([]byte("capability-1")))
+	assert.Less(t, c.keySlot([]byte("capability-2")), 4)
+	assert.Equal(t, 0, c.keySlot(nil))
+}
+
+func TestConsumer_SetConcurrencyConfigDefaults(t *testing.T) {
+	c := &Consumer{}
+	c.SetConcurrencyConfig(ConcurrencyConfig{Enabled: true})
+
+	assert.True(t, c.concurrency.Enabled)
+	assert.Equal(t, 1, c.concurrency.KeyWorkers)
+	assert.Equal(t, 100, c.concurrency.BufferSize)
+}
+
+func TestConsumer_ConsumeConcurrently(t *testing.T) {
+	const partitions, messagesPerPartition, keys = 2, 50, 5
+
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.SetConcurrencyConfig(ConcurrencyConfig{Enabled: true, KeyWorkers: keys, BufferSize: 10})
+	consumer.SetCommitConfig(CommitConfig{Count: 1, Interval: time.Hour})
+
+	var mu sync.Mutex
+	processed := map[int]map[int64]bool{}
+	order := map[string][]int64{}
+	var running, maxRunning int32
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			highest := atomic.LoadInt32(&maxRunning)
+			if current <= highest || atomic.CompareAndSwapInt32(&maxRunning, highest, current) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if processed[event.Partition] == nil {
+			processed[event.Partition] = map[int64]bool{}
+		}
+		processed[event.Partition][event.Offset] = true
+		key := fmt.Sprintf("%d/%s", event.Partition, event.Key)
+		order[key] = append(order[key], event.Offset)
+		return nil
+	})
+
+	reader := broker.reader(testTopic)
+	var gaps []string
+	reader.onCommit = func(msgs []kafka.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range msgs {
+			for offset := int64(0); offset <= msg.Offset; offset++ {
+				if !processed[msg.Partition][offset] {
+					gaps = append(gaps, fmt.Sprintf("partition %d committed up to %d before %d was processed", msg.Partition, msg.Offset, offset))
+				}
+			}
+		}
+	}
+
+	for offset := 0; offset < messagesPerPartition; offset++ {
+		for partition := 0; partition < partitions; partition++ {
+			reader.messages <- kafka.Message{
+				Topic:     testTopic,
+				Partition: partition,
+				Offset:    int64(offset),
+				Key:       []byte(fmt.Sprintf("capability-%d", offset%keys)),
+				Value:     []byte(`{"eventName": "capability_created"}`),
+			}
+		}
+	}
+	go consumer.StartConsumer(nil)
+
+	assert.Eventually(t, func() bool {
+		return reader.Committed(0) == messagesPerPartition && reader.Committed(1) == messagesPerPartition
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Empty(t, gaps)
+	assert.Greater(t, atomic.LoadInt32(&maxRunning), int32(1))
+	for key, offsets := range order {
+		assert.True(t, sort.SliceIsSorted(offsets, func(i, j int) bool { return offsets[i] < offsets[j] }), "messages with key %s processed out of order", key)
+	}
+}
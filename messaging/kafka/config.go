@@ -1,8 +1,53 @@
 package kafka
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
 type AuthConfig struct {
 	Brokers          []string          `required:"true"`
 	Mechanism        string            `required:"false"`
 	MechanismOptions map[string]string `envconfig:"MECHANISM_OPTIONS"`
 	Tls              bool              `required:"true"`
+	// ClientID identifies the service to the brokers, e.g. in their logs and quotas.
+	ClientID   string           `envconfig:"CLIENT_ID" default:"ssu-k8s"`
+	Connection ConnectionConfig `envconfig:"CONNECTION"`
+	Reader     ReaderConfig     `envconfig:"READER"`
+}
+
+// ConnectionConfig tunes the connections to the brokers, loaded from <PREFIX>_CONNECTION_*.
+type ConnectionConfig struct {
+	DialTimeout time.Duration `envconfig:"DIAL_TIMEOUT" default:"10s"`
+	// KeepAlive is the interval of TCP keep-alive probes. 0 uses the default of the operating system, -1 disables them.
+	KeepAlive time.Duration `envconfig:"KEEP_ALIVE" default:"0"`
+}
+
+// ReaderConfig tunes how consumers fetch messages, loaded from <PREFIX>_READER_*. Zero values use the
+// defaults of kafka-go.
+type ReaderConfig struct {
+	// MinBytes and MaxBytes bound the size of the batches the brokers respond to fetch requests with.
+	MinBytes int `envconfig:"MIN_BYTES" default:"1"`
+	MaxBytes int `envconfig:"MAX_BYTES" default:"1048576"`
+	// MaxWait is how long the brokers wait for MinBytes to be available before responding.
+	MaxWait time.Duration `envconfig:"MAX_WAIT" default:"10s"`
+	// StartOffset is where a consumer group without committed offsets starts, either first or last.
+	StartOffset string `envconfig:"START_OFFSET" default:"first"`
+	// QueueCapacity is the number of messages fetched ahead of processing.
+	QueueCapacity int `envconfig:"QUEUE_CAPACITY" default:"100"`
+}
+
+// startOffset returns StartOffset as an offset understood by kafka.ReaderConfig.
+func (c ReaderConfig) startOffset() (int64, error) {
+	switch strings.ToLower(c.StartOffset) {
+	case "", "first":
+		return kafka.FirstOffset, nil
+	case "last":
+		return kafka.LastOffset, nil
+	default:
+		return 0, fmt.Errorf("unsupported start offset %q, expected first or last", c.StartOffset)
+	}
 }
@@ -0,0 +1,44 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+// HeaderCorrelationId carries the correlation ID of a message, also for messages without an envelope. It is named
+// like the x-correlationId field of the envelope.
+const HeaderCorrelationId = "x-correlationId"
+
+type correlationIdKey struct{}
+
+// ContextWithCorrelationId returns a copy of ctx carrying correlationId, which is set on the messages published with it.
+// Consumers call handlers with a context carrying the correlation ID of the message being handled.
+func ContextWithCorrelationId(ctx context.Context, correlationId string) context.Context {
+	return context.WithValue(ctx, correlationIdKey{}, correlationId)
+}
+
+// CorrelationIdFromContext returns the correlation ID carried by ctx, if any.
+func CorrelationIdFromContext(ctx context.Context) (string, bool) {
+	correlationId, ok := ctx.Value(correlationIdKey{}).(string)
+	return correlationId, ok && correlationId != ""
+}
+
+// correlationIdOf returns the correlation ID of a consumed message, generating one if it has none.
+func correlationIdOf(event *model.Envelope, msg kafka.Message) string {
+	if event != nil && event.XCorrelationId != "" {
+		return event.XCorrelationId
+	}
+	if correlationId := headerValue(msg.Headers, HeaderCorrelationId); correlationId != "" {
+		return correlationId
+	}
+	return newMessageId()
+}
+
+func correlationIdFromContextOrNew(ctx context.Context) string {
+	if correlationId, ok := CorrelationIdFromContext(ctx); ok {
+		return correlationId
+	}
+	return newMessageId()
+}
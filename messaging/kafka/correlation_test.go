@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap"
+)
+
+func TestCorrelationIdOf(t *testing.T) {
+	msg := kafka.Message{Headers: []kafka.Header{{Key: HeaderCorrelationId, Value: []byte("from-header")}}}
+
+	assert.Equal(t, "from-envelope", correlationIdOf(&model.Envelope{XCorrelationId: "from-envelope"}, msg))
+	assert.Equal(t, "from-header", correlationIdOf(&model.Envelope{}, msg))
+
+	generated := correlationIdOf(&model.Envelope{}, kafka.Message{})
+	assert.Len(t, generated, 36)
+	assert.NotEqual(t, generated, correlationIdOf(&model.Envelope{}, kafka.Message{}))
+}
+
+func TestCorrelationIdFromContext(t *testing.T) {
+	_, ok := CorrelationIdFromContext(context.Background())
+	assert.False(t, ok)
+
+	correlationId, ok := CorrelationIdFromContext(ContextWithCorrelationId(context.Background(), "correlation-1"))
+	assert.True(t, ok)
+	assert.Equal(t, "correlation-1", correlationId)
+
+	assert.Equal(t, "correlation-1", correlationIdFromContextOrNew(ContextWithCorrelationId(context.Background(), "correlation-1")))
+	assert.Len(t, correlationIdFromContextOrNew(context.Background()), 36)
+}
+
+func TestConsumer_HandlerPublishIsCorrelated(t *testing.T) {
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		return event.Publish(ctx, "cloudengineering.selfservice.member", kafka.Message{Value: []byte(`{}`)})
+	})
+
+	msg := kafka.Message{Topic: testTopic, Value: []byte(`{"eventName": "capability_created", "x-correlationId": "correlation-1"}`)}
+	assert.NoError(t, consumer.processMessage(msg, nil))
+
+	published := broker.Written("cloudengineering.selfservice.member")
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, "correlation-1", headerValue(published[0].Headers, HeaderCorrelationId))
+	}
+}
+
+func TestPublisher_PublishStampsCorrelationId(t *testing.T) {
+	broker := newTestBroker()
+	p := NewPublisherWithBroker(broker, AuthConfig{}, nil, zap.NewNop(), context.Background())
+	assert.NoError(t, p.Publish(testTopic,
+		kafka.Message{Value: []byte(`{}`)},
+		kafka.Message{Value: []byte(`{}`), Headers: []kafka.Header{{Key: HeaderCorrelationId, Value: []byte("correlation-1")}}},
+	))
+
+	published := broker.Written(testTopic)
+	if assert.Len(t, published, 2) {
+		assert.Len(t, headerValue(published[0].Headers, HeaderCorrelationId), 36)
+		assert.Equal(t, "correlation-1", headerValue(published[1].Headers, HeaderCorrelationId))
+	}
+}
+
+func TestPublisher_PublishAsyncStampsCorrelationId(t *testing.T) {
+	broker := newTestBroker()
+	p := NewPublisherWithBroker(broker, AuthConfig{}, nil, zap.NewNop(), context.Background())
+	delivered := make(chan error, 2)
+	callback := func(delivery Delivery, err error) { delivered <- err }
+
+	ctx := ContextWithCorrelationId(context.Background(), "correlation-1")
+	assert.NoError(t, p.PublishAsync(ctx, testTopic, kafka.Message{Value: []byte(`{}`)}, callback))
+	assert.NoError(t, p.PublishAsync(context.Background(), testTopic, kafka.Message{Value: []byte(`{}`)}, callback))
+	assert.NoError(t, <-delivered)
+	assert.NoError(t, <-delivered)
+
+	published := broker.Written(testTopic)
+	if assert.Len(t, published, 2) {
+		assert.Equal(t, "correlation-1", headerValue(published[0].Headers, HeaderCorrelationId))
+		assert.Len(t, headerValue(published[1].Headers, HeaderCorrelationId), 36)
+	}
+}
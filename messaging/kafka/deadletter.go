@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Reasons for sending a message to the dead-letter topic, set in the DeadLetterHeaderReason header.
+const (
+	DeadLetterReasonHandlerFailed   = "handler-failed"
+	DeadLetterReasonInvalidPayload  = "invalid-payload"
+	DeadLetterReasonInvalidJson     = "invalid-json"
+	DeadLetterReasonUnknownEnvelope = "unknown-envelope"
+)
+
+// Headers describing why a message ended up on the dead-letter topic.
+const (
+	DeadLetterHeaderReason            = "x-dlq-reason"
+	DeadLetterHeaderError             = "x-dlq-error"
+	DeadLetterHeaderHandler           = "x-dlq-handler"
+	DeadLetterHeaderAttempts          = "x-dlq-attempts"
+	DeadLetterHeaderOriginalTopic     = "x-dlq-original-topic"
+	DeadLetterHeaderOriginalPartition = "x-dlq-original-partition"
+	DeadLetterHeaderOriginalOffset    = "x-dlq-original-offset"
+	DeadLetterHeaderTimestamp         = "x-dlq-timestamp"
+)
+
+type DeadLetterConfig struct {
+	// Topic is where messages are published once the consumer gives up on them.
+	Topic string
+	// IncludeInvalid also sends messages that aren't valid JSON or have an unknown envelope to Topic,
+	// instead of skipping them.
+	IncludeInvalid bool
+}
+
+// EnableDeadLetter makes the consumer publish messages it gives up on to a dead-letter topic and carry on,
+// instead of stopping.
+func (c *Consumer) EnableDeadLetter(config DeadLetterConfig) {
+	c.deadLetter = &config
+}
+
+func (c *Consumer) publishDeadLetter(msg kafka.Message, reason string, handler string, attempts int, cause error) error {
+	partition, offset := c.originalPosition(msg)
+	// Headers are replaced rather than appended, so a replayed message that ends up here again isn't given duplicates
+	headers := make([]kafka.Header, 0, len(msg.Headers)+8)
+	headers = append(headers, msg.Headers...)
+	headers = setHeader(headers, DeadLetterHeaderReason, reason)
+	headers = setHeader(headers, DeadLetterHeaderHandler, handler)
+	headers = setHeader(headers, DeadLetterHeaderAttempts, strconv.Itoa(attempts))
+	headers = setHeader(headers, DeadLetterHeaderOriginalTopic, c.sourceTopic)
+	headers = setHeader(headers, DeadLetterHeaderOriginalPartition, partition)
+	headers = setHeader(headers, DeadLetterHeaderOriginalOffset, offset)
+	headers = setHeader(headers, DeadLetterHeaderTimestamp, time.Now().UTC().Format(time.RFC3339Nano))
+	if cause != nil {
+		headers = setHeader(headers, DeadLetterHeaderError, cause.Error())
+	} else {
+		headers = removeHeader(headers, DeadLetterHeaderError)
+	}
+
+	return c.publisher.Publish(c.deadLetter.Topic, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+// deadLetterInvalid sends a message that couldn't be recognised to the dead-letter topic, if enabled. An error is
+// returned if publishing fails, so the message isn't committed and dropped.
+func (c *Consumer) deadLetterInvalid(msg kafka.Message, reason string, cause error, msgLog *zap.Logger) error {
+	if c.deadLetter == nil || !c.deadLetter.IncludeInvalid {
+		return nil
+	}
+
+	err := c.publishDeadLetter(msg, reason, "", 0, cause)
+	if err != nil {
+		msgLog.Error("Unable to publish message to dead-letter topic", zap.Error(err))
+		return err
+	}
+	msgLog.Info("Message published to dead-letter topic", zap.String("deadLetterTopic", c.deadLetter.Topic))
+	return nil
+}
@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+const (
+	testTopic           = "cloudengineering.selfservice.capability"
+	testDeadLetterTopic = "cloudengineering.selfservice.capability.dlq"
+)
+
+func TestConsumer_DeadLetterHandlerFailed(t *testing.T) {
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic})
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		return errors.New("capability service unavailable")
+	})
+
+	msg := kafka.Message{
+		Topic:     testTopic,
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("sandbox-abcd"),
+		Value:     []byte(`{"eventName": "capability_created", "payload": {}}`),
+		Headers:   []kafka.Header{{Key: "x-sender", Value: []byte("test")}},
+	}
+	assert.NoError(t, consumer.processMessage(msg, nil))
+
+	published := broker.Written(testDeadLetterTopic)
+	if assert.Len(t, published, 1) {
+		deadLetter := published[0]
+		assert.Equal(t, msg.Key, deadLetter.Key)
+		assert.Equal(t, msg.Value, deadLetter.Value)
+		assert.Equal(t, "test", headerValue(deadLetter.Headers, "x-sender"))
+		assert.Equal(t, DeadLetterReasonHandlerFailed, headerValue(deadLetter.Headers, DeadLetterHeaderReason))
+		assert.Equal(t, "capability_created", headerValue(deadLetter.Headers, DeadLetterHeaderHandler))
+		assert.Equal(t, "1", headerValue(deadLetter.Headers, DeadLetterHeaderAttempts))
+		assert.Equal(t, "capability service unavailable", headerValue(deadLetter.Headers, DeadLetterHeaderError))
+		assert.Equal(t, testTopic, headerValue(deadLetter.Headers, DeadLetterHeaderOriginalTopic))
+		assert.Equal(t, "2", headerValue(deadLetter.Headers, DeadLetterHeaderOriginalPartition))
+		assert.Equal(t, "42", headerValue(deadLetter.Headers, DeadLetterHeaderOriginalOffset))
+		assert.NotEmpty(t, headerValue(deadLetter.Headers, DeadLetterHeaderTimestamp))
+	}
+}
+
+func TestConsumer_DeadLetterReplayed(t *testing.T) {
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic})
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		return errors.New("capability service unavailable")
+	})
+
+	msg := kafka.Message{Topic: testTopic, Partition: 2, Offset: 42, Value: []byte(`{"eventName": "capability_created", "payload": {}}`)}
+	assert.NoError(t, consumer.processMessage(msg, nil))
+
+	// A dead letter replayed onto the topic, which fails again, has its headers replaced rather than duplicated
+	replayed := broker.Written(testDeadLetterTopic)[0]
+	replayed.Topic, replayed.Partition, replayed.Offset = testTopic, 0, 7
+	assert.NoError(t, consumer.processMessage(replayed, nil))
+
+	published := broker.Written(testDeadLetterTopic)
+	if assert.Len(t, published, 2) {
+		keys := map[string]int{}
+		for _, header := range published[1].Headers {
+			keys[header.Key]++
+		}
+		for key, count := range keys {
+			assert.Equal(t, 1, count, key)
+		}
+		assert.Equal(t, "0", headerValue(published[1].Headers, DeadLetterHeaderOriginalPartition))
+		assert.Equal(t, "7", headerValue(published[1].Headers, DeadLetterHeaderOriginalOffset))
+	}
+}
+
+func TestConsumer_DeadLetterDisabled(t *testing.T) {
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		return errors.New("capability service unavailable")
+	})
+
+	err := consumer.processMessage(kafka.Message{Topic: testTopic, Value: []byte(`{"eventName": "capability_created"}`)}, nil)
+	assert.EqualError(t, err, "capability service unavailable")
+	assert.Empty(t, broker.Written(testDeadLetterTopic))
+}
+
+func TestConsumer_DeadLetterInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		value  string
+		reason string
+	}{
+		{name: "invalid json", value: `{"eventName": `, reason: DeadLetterReasonInvalidJson},
+		{name: "unknown envelope", value: `{"capabilityId": "sandbox-abcd"}`, reason: DeadLetterReasonUnknownEnvelope},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			broker := newTestBroker()
+			consumer := newTestConsumer(t, broker, testTopic)
+
+			// Invalid messages are skipped, unless they are included in the dead-letter topic
+			msg := kafka.Message{Topic: testTopic, Value: []byte(test.value)}
+			consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic})
+			assert.NoError(t, consumer.processMessage(msg, nil))
+			assert.Empty(t, broker.Written(testDeadLetterTopic))
+
+			consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic, IncludeInvalid: true})
+			assert.NoError(t, consumer.processMessage(msg, nil))
+			published := broker.Written(testDeadLetterTopic)
+			if assert.Len(t, published, 1) {
+				assert.Equal(t, test.reason, headerValue(published[0].Headers, DeadLetterHeaderReason))
+			}
+		})
+	}
+}
+
+func TestConsumer_DeadLetterInvalidPublishFails(t *testing.T) {
+	broker := newTestBroker()
+	broker.writeErr = errors.New("broker unavailable")
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic, IncludeInvalid: true})
+
+	// The message must not be committed, so it is processed again rather than lost
+	err := consumer.processMessage(kafka.Message{Topic: testTopic, Value: []byte(`{"eventName": `)}, nil)
+	assert.EqualError(t, err, "broker unavailable")
+}
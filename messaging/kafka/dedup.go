@@ -0,0 +1,248 @@
+package kafka
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.dfds.cloud/messaging/kafka/registry"
+	"go.uber.org/zap"
+)
+
+// DeduplicationStore keeps track of processed messages, so messages redelivered by Kafka are only handled once.
+type DeduplicationStore interface {
+	// Process calls f unless id has already been processed, and records id as processed if f succeeds.
+	// duplicate is true if f was skipped.
+	Process(ctx context.Context, id string, f func(ctx context.Context) error) (duplicate bool, err error)
+}
+
+// EnableDeduplication makes the consumer skip messages that have already been processed, according to store.
+// Messages are identified by DeduplicationKey.
+func (c *Consumer) EnableDeduplication(store DeduplicationStore) {
+	c.deduplication = store
+}
+
+// DeduplicationKey identifies the message of hc. The MessageId of the envelope is used if set, otherwise the
+// topic, partition and offset of the message.
+func DeduplicationKey(hc model.HandlerContext) string {
+	if hc.Event != nil && hc.Event.MessageId != "" {
+		return hc.Event.MessageId
+	}
+	return fmt.Sprintf("%s/%d/%d", hc.Topic, hc.Partition, hc.Offset)
+}
+
+// handle calls handler, skipping messages that have already been processed if deduplication is enabled.
+func (c *Consumer) handle(ctx context.Context, handler registry.HandlerFunc, hc model.HandlerContext, eventLog *zap.Logger) error {
+	if c.deduplication == nil {
+		return handler(ctx, hc)
+	}
+
+	key := DeduplicationKey(hc)
+	duplicate, err := c.deduplication.Process(ctx, key, func(ctx context.Context) error {
+		return handler(ctx, hc)
+	})
+	if duplicate {
+		eventLog.Info("Message has already been processed, skipping", zap.String("deduplicationKey", key))
+	}
+
+	return err
+}
+
+// MemoryDeduplicationStore is a DeduplicationStore that remembers the most recently processed messages in memory.
+// It doesn't survive restarts and isn't shared between replicas, so it only protects against redeliveries to the
+// same process.
+type MemoryDeduplicationStore struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryDeduplicationEntry struct {
+	id          string
+	processedAt time.Time
+	// reserved is true while the message is being processed
+	reserved bool
+}
+
+// NewMemoryDeduplicationStore creates a MemoryDeduplicationStore remembering up to size messages for ttl.
+// A ttl of 0 keeps messages until they are evicted by newer ones.
+func NewMemoryDeduplicationStore(size int, ttl time.Duration) *MemoryDeduplicationStore {
+	return &MemoryDeduplicationStore{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Process reserves id before calling f, so a message redelivered while it is still being processed is skipped as
+// well. The reservation is released if f fails, so the message can be processed again.
+func (s *MemoryDeduplicationStore) Process(ctx context.Context, id string, f func(ctx context.Context) error) (bool, error) {
+	if !s.reserve(id) {
+		return true, nil
+	}
+
+	err := f(ctx)
+	if err != nil {
+		s.release(id)
+		return false, err
+	}
+
+	s.add(id)
+	return false, nil
+}
+
+// Contains reports whether id has been processed and hasn't expired yet.
+func (s *MemoryDeduplicationStore) Contains(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.lookup(id)
+	return exists && !entry.reserved
+}
+
+// lookup returns the entry of id, removing it if it has expired. s.mu must be held.
+func (s *MemoryDeduplicationStore) lookup(id string) (*memoryDeduplicationEntry, bool) {
+	element, exists := s.entries[id]
+	if !exists {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryDeduplicationEntry)
+	if !entry.reserved && s.ttl > 0 && time.Since(entry.processedAt) > s.ttl {
+		s.order.Remove(element)
+		delete(s.entries, id)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// reserve reserves id for processing, unless it has already been processed or reserved.
+func (s *MemoryDeduplicationStore) reserve(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.lookup(id); exists {
+		return false
+	}
+	s.push(&memoryDeduplicationEntry{id: id, reserved: true})
+	return true
+}
+
+func (s *MemoryDeduplicationStore) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, exists := s.entries[id]; exists && element.Value.(*memoryDeduplicationEntry).reserved {
+		s.order.Remove(element)
+		delete(s.entries, id)
+	}
+}
+
+func (s *MemoryDeduplicationStore) add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, exists := s.entries[id]; exists {
+		entry := element.Value.(*memoryDeduplicationEntry)
+		entry.processedAt = time.Now()
+		entry.reserved = false
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.push(&memoryDeduplicationEntry{id: id, processedAt: time.Now()})
+}
+
+// push adds entry as the most recent one, evicting the oldest entries beyond size. s.mu must be held.
+func (s *MemoryDeduplicationStore) push(entry *memoryDeduplicationEntry) {
+	s.entries[entry.id] = s.order.PushFront(entry)
+	for s.size > 0 && s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryDeduplicationEntry).id)
+	}
+}
+
+var validTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+type deduplicationTxKey struct{}
+
+// DeduplicationTx returns the transaction a message is recorded as processed in by SQLDeduplicationStore.
+// Handlers writing to the same database should use it, so their changes and the message being recorded as
+// processed are committed together.
+func DeduplicationTx(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(deduplicationTxKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// SQLDeduplicationStore is a DeduplicationStore that records processed messages in a database table. The
+// message is recorded in the same transaction the handler can use through DeduplicationTx, and the transaction
+// is only committed if the handler succeeds.
+//
+// Queries use $n placeholders and ON CONFLICT, as supported by PostgreSQL and SQLite.
+type SQLDeduplicationStore struct {
+	db    *sql.DB
+	table string
+}
+
+func NewSQLDeduplicationStore(db *sql.DB, table string) (*SQLDeduplicationStore, error) {
+	if !validTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &SQLDeduplicationStore{db: db, table: table}, nil
+}
+
+// EnsureSchema creates the table of the store if it doesn't exist.
+func (s *SQLDeduplicationStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	message_id VARCHAR(255) PRIMARY KEY,
+	processed_at TIMESTAMP NOT NULL
+)`, s.table))
+	return err
+}
+
+func (s *SQLDeduplicationStore) Process(ctx context.Context, id string, f func(ctx context.Context) error) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Inserting first makes concurrent deliveries of the same message wait for each other
+	result, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (message_id, processed_at) VALUES ($1, $2) ON CONFLICT (message_id) DO NOTHING", s.table), id, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		return true, nil
+	}
+
+	err = f(context.WithValue(ctx, deduplicationTxKey{}, tx))
+	if err != nil {
+		return false, err
+	}
+
+	return false, tx.Commit()
+}
+
+// Cleanup deletes messages processed before olderThan, returning how many were deleted.
+func (s *SQLDeduplicationStore) Cleanup(ctx context.Context, olderThan time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE processed_at < $1", s.table), olderThan.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+	_ "modernc.org/sqlite"
+)
+
+func TestDeduplicationKey(t *testing.T) {
+	assert.Equal(t, "abc", DeduplicationKey(model.HandlerContext{Event: &model.Envelope{MessageId: "abc"}, Topic: "topic"}))
+	assert.Equal(t, "topic/2/42", DeduplicationKey(model.HandlerContext{Event: &model.Envelope{}, Topic: "topic", Partition: 2, Offset: 42}))
+}
+
+func TestMemoryDeduplicationStore(t *testing.T) {
+	store := NewMemoryDeduplicationStore(2, 0)
+	calls := 0
+	f := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+
+	duplicate, err := store.Process(context.Background(), "1", f)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+	duplicate, err = store.Process(context.Background(), "1", f)
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, 1, calls)
+
+	// Failed messages aren't recorded
+	_, err = store.Process(context.Background(), "2", func(ctx context.Context) error { return errors.New("failed") })
+	assert.Error(t, err)
+	assert.False(t, store.Contains("2"))
+
+	// The least recently processed message is evicted
+	store.Process(context.Background(), "2", f)
+	store.Process(context.Background(), "3", f)
+	assert.False(t, store.Contains("1"))
+	assert.True(t, store.Contains("2"))
+	assert.True(t, store.Contains("3"))
+
+	expiring := NewMemoryDeduplicationStore(10, time.Millisecond)
+	expiring.Process(context.Background(), "1", f)
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, expiring.Contains("1"))
+}
+
+func TestMemoryDeduplicationStore_Concurrent(t *testing.T) {
+	store := NewMemoryDeduplicationStore(10, 0)
+	processing, finish, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		store.Process(context.Background(), "1", func(ctx context.Context) error {
+			close(processing)
+			<-finish
+			return errors.New("failed")
+		})
+	}()
+	<-processing
+
+	// A redelivery while the message is being processed is skipped
+	duplicate, err := store.Process(context.Background(), "1", func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.False(t, store.Contains("1"))
+	close(finish)
+	<-done
+
+	// The reservation is released when processing fails
+	duplicate, err = store.Process(context.Background(), "1", func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.True(t, store.Contains("1"))
+}
+
+func TestSQLDeduplicationStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = NewSQLDeduplicationStore(db, "processed; DROP TABLE x")
+	assert.Error(t, err)
+
+	store, err := NewSQLDeduplicationStore(db, "processed_messages")
+	assert.NoError(t, err)
+	assert.NoError(t, store.EnsureSchema(context.Background()))
+	_, err = db.Exec("CREATE TABLE capabilities (id TEXT)")
+	assert.NoError(t, err)
+
+	insertCapability := func(id string, fail bool) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			tx, ok := DeduplicationTx(ctx)
+			assert.True(t, ok)
+			_, err := tx.ExecContext(ctx, "INSERT INTO capabilities (id) VALUES ($1)", id)
+			assert.NoError(t, err)
+			if fail {
+				return errors.New("failed")
+			}
+			return nil
+		}
+	}
+
+	// Changes of a failing handler are rolled back together with the message being recorded
+	duplicate, err := store.Process(context.Background(), "1", insertCapability("a", true))
+	assert.Error(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = store.Process(context.Background(), "1", insertCapability("b", false))
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+
+	duplicate, err = store.Process(context.Background(), "1", insertCapability("c", false))
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+
+	var ids []string
+	rows, err := db.Query("SELECT id FROM capabilities")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var id string
+		assert.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	rows.Close()
+	assert.Equal(t, []string{"b"}, ids)
+
+	deleted, err := store.Cleanup(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -2,58 +2,142 @@ package kafka
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl"
 	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"go.dfds.cloud/messaging/kafka/oauthbearer"
 	"strings"
 	"time"
 )
 
+// NewDialer creates a dialer for authConfig, which is expected to be loaded with envconfig from envPrefix, so its
+// defaults are applied.
 func NewDialer(envPrefix string, authConfig AuthConfig) (*kafka.Dialer, error) {
 	// Configure TLS
 
 	var tlsConfig *tls.Config
-	var saslMechanism sasl.Mechanism
-
 	if authConfig.Tls {
-		tlsConfig = &tls.Config{
-			MinVersion:               tls.VersionTLS12,
-			CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-			PreferServerCipherSuites: true,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-				tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-			},
+		var err error
+		tlsConfig, err = loadTLSConfig(envPrefix)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	// Configure SASL mechanism
-	for k, v := range authConfig.MechanismOptions {
-		fmt.Printf("Key: %s, Value: %s\n", k, v)
+	saslMechanism, err := newSASLMechanism(envPrefix, authConfig.Mechanism)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure connection dialer
+	if _, err = authConfig.Reader.startOffset(); err != nil {
+		return nil, err
 	}
 
-	switch strings.ToLower(authConfig.Mechanism) {
+	return &kafka.Dialer{
+		Timeout:       authConfig.Connection.DialTimeout,
+		KeepAlive:     authConfig.Connection.KeepAlive,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: saslMechanism,
+		ClientID:      authConfig.ClientID,
+	}, nil
+}
+
+// scramConfig holds the credentials for the SCRAM mechanisms, loaded from <PREFIX>_MECHANISM_SCRAM_*.
+type scramConfig struct {
+	Username string `required:"true"`
+	Password string `required:"true"`
+}
+
+// oauthBearerConfig configures the OAUTHBEARER mechanism, loaded from <PREFIX>_MECHANISM_OAUTHBEARER_*.
+type oauthBearerConfig struct {
+	// Source is where tokens come from, one of client-credentials, static or file.
+	Source       string `default:"client-credentials"`
+	TokenUrl     string `envconfig:"TOKEN_URL"`
+	ClientId     string `envconfig:"CLIENT_ID"`
+	ClientSecret string `envconfig:"CLIENT_SECRET"`
+	Scope        string
+	Token        string
+	TokenFile    string `envconfig:"TOKEN_FILE"`
+	// Extensions are sent along with the token, e.g. logicalCluster:lkc-abc,identityPoolId:pool-abc for Confluent Cloud.
+	Extensions map[string]string
+	// RefreshBefore is how long before they expire tokens of the client-credentials source are refreshed.
+	RefreshBefore time.Duration `envconfig:"REFRESH_BEFORE" default:"1m"`
+}
+
+func newOAuthBearerMechanism(conf oauthBearerConfig) (sasl.Mechanism, error) {
+	var source oauthbearer.TokenSource
+	switch strings.ToLower(conf.Source) {
+	case "client-credentials":
+		if conf.TokenUrl == "" || conf.ClientId == "" {
+			return nil, errors.New("the client-credentials token source requires TOKEN_URL and CLIENT_ID")
+		}
+		// Only tokens from the endpoint are cached, as the file is read for every connection to pick up rotated tokens
+		source = oauthbearer.NewCachingTokenSource(oauthbearer.ClientCredentialsTokenSource{
+			TokenUrl:     conf.TokenUrl,
+			ClientId:     conf.ClientId,
+			ClientSecret: conf.ClientSecret,
+			Scope:        conf.Scope,
+		}, conf.RefreshBefore)
+	case "static":
+		if conf.Token == "" {
+			return nil, errors.New("the static token source requires TOKEN")
+		}
+		source = oauthbearer.StaticTokenSource{Value: conf.Token}
+	case "file":
+		if conf.TokenFile == "" {
+			return nil, errors.New("the file token source requires TOKEN_FILE")
+		}
+		source = oauthbearer.FileTokenSource{Path: conf.TokenFile}
+	default:
+		return nil, fmt.Errorf("unsupported OAUTHBEARER token source %q, expected one of client-credentials, static or file", conf.Source)
+	}
+
+	return oauthbearer.Mechanism{
+		Source:     source,
+		Extensions: conf.Extensions,
+	}, nil
+}
+
+// newSASLMechanism creates the SASL mechanism named mechanism, configured through <PREFIX>_MECHANISM_<NAME>_*.
+// No mechanism is used if mechanism is empty.
+func newSASLMechanism(envPrefix string, mechanism string) (sasl.Mechanism, error) {
+	switch strings.ToLower(mechanism) {
+	case "":
+		return nil, nil
 	case "plain":
 		var plainConf plain.Mechanism
 		err := envconfig.Process(fmt.Sprintf("%s_MECHANISM_PLAIN", envPrefix), &plainConf)
 		if err != nil {
 			return nil, err
 		}
-		saslMechanism = plainConf
+		return plainConf, nil
+	case "scram-sha-256", "scram-sha-512":
+		var scramConf scramConfig
+		err := envconfig.Process(fmt.Sprintf("%s_MECHANISM_SCRAM", envPrefix), &scramConf)
+		if err != nil {
+			return nil, err
+		}
+
+		algorithm := scram.SHA256
+		if strings.ToLower(mechanism) == "scram-sha-512" {
+			algorithm = scram.SHA512
+		}
+		return scram.Mechanism(algorithm, scramConf.Username, scramConf.Password)
+	case "oauthbearer":
+		var oauthConf oauthBearerConfig
+		err := envconfig.Process(fmt.Sprintf("%s_MECHANISM_OAUTHBEARER", envPrefix), &oauthConf)
+		if err != nil {
+			return nil, err
+		}
+		return newOAuthBearerMechanism(oauthConf)
 	default:
-		saslMechanism = nil
+		return nil, fmt.Errorf("unsupported SASL mechanism %q, expected one of plain, scram-sha-256, scram-sha-512 or oauthbearer", mechanism)
 	}
-
-	// Configure connection dialer
-	return &kafka.Dialer{
-		Timeout:       10 * time.Second,
-		DualStack:     true,
-		TLS:           tlsConfig,
-		SASLMechanism: saslMechanism,
-		ClientID:      "ssu-k8s",
-	}, nil
 }
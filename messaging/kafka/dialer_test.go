@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSASLMechanism(t *testing.T) {
+	t.Setenv("TEST_KAFKA_MECHANISM_PLAIN_USERNAME", "plain-user")
+	t.Setenv("TEST_KAFKA_MECHANISM_PLAIN_PASSWORD", "plain-password")
+	t.Setenv("TEST_KAFKA_MECHANISM_SCRAM_USERNAME", "scram-user")
+	t.Setenv("TEST_KAFKA_MECHANISM_SCRAM_PASSWORD", "scram-password")
+
+	mechanism, err := newSASLMechanism("TEST_KAFKA", "")
+	assert.NoError(t, err)
+	assert.Nil(t, mechanism)
+
+	mechanism, err = newSASLMechanism("TEST_KAFKA", "plain")
+	assert.NoError(t, err)
+	assert.Equal(t, plain.Mechanism{Username: "plain-user", Password: "plain-password"}, mechanism)
+
+	for input, name := range map[string]string{"scram-sha-256": "SCRAM-SHA-256", "SCRAM-SHA-512": "SCRAM-SHA-512"} {
+		mechanism, err = newSASLMechanism("TEST_KAFKA", input)
+		assert.NoError(t, err)
+		assert.Equal(t, name, mechanism.Name())
+
+		_, clientFirst, err := mechanism.Start(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(clientFirst), "n,,n=scram-user,r="))
+	}
+
+	_, err = newSASLMechanism("TEST_KAFKA", "gssapi")
+	assert.ErrorContains(t, err, "unsupported SASL mechanism")
+}
+
+func TestNewSASLMechanismMissingCredentials(t *testing.T) {
+	_, err := newSASLMechanism("TEST_KAFKA_MISSING", "scram-sha-512")
+	assert.Error(t, err)
+}
+
+func TestNewDialerUnknownMechanism(t *testing.T) {
+	_, err := NewDialer("TEST_KAFKA", AuthConfig{Brokers: []string{"localhost:9092"}, Mechanism: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestNewSASLMechanismOAuthBearer(t *testing.T) {
+	t.Setenv("TEST_KAFKA_MECHANISM_OAUTHBEARER_SOURCE", "static")
+	t.Setenv("TEST_KAFKA_MECHANISM_OAUTHBEARER_TOKEN", "abc")
+	t.Setenv("TEST_KAFKA_MECHANISM_OAUTHBEARER_EXTENSIONS", "logicalCluster:lkc-1")
+
+	mechanism, err := newSASLMechanism("TEST_KAFKA", "OAUTHBEARER")
+	assert.NoError(t, err)
+	_, response, err := mechanism.Start(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "n,,\x01auth=Bearer abc\x01logicalCluster=lkc-1\x01\x01", string(response))
+
+	t.Setenv("TEST_KAFKA_MECHANISM_OAUTHBEARER_SOURCE", "client-credentials")
+	_, err = newSASLMechanism("TEST_KAFKA", "oauthbearer")
+	assert.ErrorContains(t, err, "TOKEN_URL")
+}
+
+func TestNewSASLMechanismOAuthBearerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("token-1"), 0600))
+	t.Setenv("TEST_KAFKA_MECHANISM_OAUTHBEARER_SOURCE", "file")
+	t.Setenv("TEST_KAFKA_MECHANISM_OAUTHBEARER_TOKEN_FILE", path)
+
+	mechanism, err := newSASLMechanism("TEST_KAFKA", "oauthbearer")
+	assert.NoError(t, err)
+	_, response, err := mechanism.Start(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "n,,\x01auth=Bearer token-1\x01\x01", string(response))
+
+	// Rotated tokens are picked up by the next connection
+	assert.NoError(t, os.WriteFile(path, []byte("token-2"), 0600))
+	_, response, err = mechanism.Start(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "n,,\x01auth=Bearer token-2\x01\x01", string(response))
+}
+
+func TestNewDialerConnectionConfig(t *testing.T) {
+	t.Setenv("TEST_KAFKA_CONFIG_BROKERS", "localhost:9092")
+	t.Setenv("TEST_KAFKA_CONFIG_TLS", "false")
+	t.Setenv("TEST_KAFKA_CONFIG_CLIENT_ID", "capability-service")
+	t.Setenv("TEST_KAFKA_CONFIG_CONNECTION_DIAL_TIMEOUT", "3s")
+	t.Setenv("TEST_KAFKA_CONFIG_CONNECTION_KEEP_ALIVE", "30s")
+	t.Setenv("TEST_KAFKA_CONFIG_READER_START_OFFSET", "last")
+	t.Setenv("TEST_KAFKA_CONFIG_READER_MAX_WAIT", "500ms")
+	t.Setenv("TEST_KAFKA_DEFAULT_CONFIG_BROKERS", "localhost:9092")
+	t.Setenv("TEST_KAFKA_DEFAULT_CONFIG_TLS", "false")
+
+	var authConfig AuthConfig
+	assert.NoError(t, envconfig.Process("TEST_KAFKA_CONFIG", &authConfig))
+	assert.Equal(t, 1, authConfig.Reader.MinBytes)
+	assert.Equal(t, 500*time.Millisecond, authConfig.Reader.MaxWait)
+	startOffset, err := authConfig.Reader.startOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, kafka.LastOffset, startOffset)
+
+	dialer, err := NewDialer("TEST_KAFKA_CONFIG", authConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "capability-service", dialer.ClientID)
+	assert.Equal(t, 3*time.Second, dialer.Timeout)
+	assert.Equal(t, 30*time.Second, dialer.KeepAlive)
+
+	// The defaults come from envconfig
+	var defaultConfig AuthConfig
+	assert.NoError(t, envconfig.Process("TEST_KAFKA_DEFAULT_CONFIG", &defaultConfig))
+	dialer, err = NewDialer("TEST_KAFKA_DEFAULT_CONFIG", defaultConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "ssu-k8s", dialer.ClientID)
+	assert.Equal(t, 10*time.Second, dialer.Timeout)
+
+	authConfig.Reader.StartOffset = "middle"
+	_, err = NewDialer("TEST_KAFKA_CONFIG", authConfig)
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+// HeaderMessageId is set on messages published with PublishEvent, carrying the messageId of the envelope.
+const HeaderMessageId = "x-message-id"
+
+// Delivery describes where a published message ended up. Partition and Offset are -1 if the writer of the Broker
+// didn't report the delivery, i.e. it doesn't call the Completion of the kafka.Writer it was created from.
+type Delivery struct {
+	MessageId string
+	Topic     string
+	Partition int
+	Offset    int64
+	Timestamp time.Time
+}
+
+type publishOptions struct {
+	messageId     string
+	correlationId string
+	headers       []kafka.Header
+}
+
+type PublishOption func(options *publishOptions)
+
+// WithMessageId sets the messageId of the envelope, instead of generating one.
+func WithMessageId(messageId string) PublishOption {
+	return func(options *publishOptions) {
+		options.messageId = messageId
+	}
+}
+
+// WithCorrelationId sets the correlation ID of the envelope, instead of taking it from the context.
+func WithCorrelationId(correlationId string) PublishOption {
+	return func(options *publishOptions) {
+		options.correlationId = correlationId
+	}
+}
+
+// WithHeaders adds headers to the published message.
+func WithHeaders(headers ...kafka.Header) PublishOption {
+	return func(options *publishOptions) {
+		options.headers = append(options.headers, headers...)
+	}
+}
+
+// PublishEvent publishes payload to topic wrapped in the standard envelope, and returns where it was delivered.
+// The messageId is generated, x-sender is taken from the Sender of the PublisherConfig and x-correlationId from ctx,
+// or generated if ctx doesn't carry one.
+func PublishEvent[T any](ctx context.Context, p *Publisher, topic string, key string, eventName string, version string, payload T, opts ...PublishOption) (Delivery, error) {
+	msg, err := p.eventMessage(ctx, key, eventName, version, payload, opts)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return p.publishTracked(ctx, topic, msg)
+}
+
+func (p *Publisher) eventMessage(ctx context.Context, key string, eventName string, version string, payload interface{}, opts []PublishOption) (kafka.Message, error) {
+	options := publishOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.messageId == "" {
+		options.messageId = newMessageId()
+	}
+	if options.correlationId == "" {
+		options.correlationId = correlationIdFromContextOrNew(ctx)
+	}
+
+	p.mu.Lock()
+	sender := p.config.Sender
+	p.mu.Unlock()
+
+	value, err := json.Marshal(model.EnvelopeWithPayload[interface{}]{
+		MessageId:      options.messageId,
+		EventName:      eventName,
+		Version:        version,
+		XCorrelationId: options.correlationId,
+		XSender:        sender,
+		Payload:        payload,
+	})
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	headers := setHeader(options.headers, HeaderMessageId, options.messageId)
+	headers = setHeader(headers, HeaderCorrelationId, options.correlationId)
+
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: headers,
+	}, nil
+}
+
+// publishTracked publishes msg and waits for the report of its delivery, which is matched on HeaderMessageId.
+func (p *Publisher) publishTracked(ctx context.Context, topic string, msg kafka.Message) (Delivery, error) {
+	writer, err := p.writer(topic)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	messageId := headerValue(msg.Headers, HeaderMessageId)
+	delivered := make(chan Delivery, 1)
+	_, awaiting := p.deliveries.LoadOrStore(messageId, DeliveryCallback(func(delivery Delivery, err error) {
+		delivered <- delivery
+	}))
+	if awaiting {
+		return Delivery{}, errAwaitingDelivery(messageId)
+	}
+	defer p.deliveries.Delete(messageId)
+
+	err = writer.WriteMessages(ctx, msg)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	// The writer reports deliveries before WriteMessages returns
+	select {
+	case delivery := <-delivered:
+		return delivery, nil
+	default:
+		return Delivery{MessageId: messageId, Topic: topic, Partition: -1, Offset: -1}, nil
+	}
+}
+
+// completion is called by writers once messages have been written, or failed to be, reporting deliveries of tracked messages.
+func (p *Publisher) completion(messages []kafka.Message, err error) {
+	m := p.metricsOf()
+	for _, msg := range messages {
+		m.observe(msg.Topic, err)
+
+		messageId := headerValue(msg.Headers, HeaderMessageId)
+		if messageId == "" {
+			continue
+		}
+
+		report, exists := p.deliveries.LoadAndDelete(messageId)
+		if !exists {
+			continue
+		}
+
+		report.(DeliveryCallback)(Delivery{
+			MessageId: messageId,
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Timestamp: msg.Time,
+		}, err)
+	}
+}
+
+// newMessageId generates a random (version 4) UUID.
+func newMessageId() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err) // ideally this should never happen
+	}
+	buf[6] = (buf[6] & 0x0f) | 0x40
+	buf[8] = (buf[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap"
+)
+
+func TestPublisher_EventMessage(t *testing.T) {
+	p := NewPublisher(AuthConfig{}, nil, zap.NewNop(), context.Background())
+	config := DefaultPublisherConfig()
+	config.Sender = "capability-service"
+	p.SetConfig(config)
+
+	ctx := ContextWithCorrelationId(context.Background(), "correlation-1")
+	msg, err := p.eventMessage(ctx, "sandbox-abcd", "capability_created", "1", capabilityCreated{CapabilityId: "sandbox-abcd"}, []PublishOption{
+		WithHeaders(kafka.Header{Key: "x-extra", Value: []byte("value")}),
+	})
+	assert.NoError(t, err)
+
+	var envelope model.EnvelopeWithPayload[capabilityCreated]
+	assert.NoError(t, json.Unmarshal(msg.Value, &envelope))
+	assert.Equal(t, "capability_created", envelope.EventName)
+	assert.Equal(t, "1", envelope.Version)
+	assert.Equal(t, "capability-service", envelope.XSender)
+	assert.Equal(t, "correlation-1", envelope.XCorrelationId)
+	assert.Equal(t, "sandbox-abcd", envelope.Payload.CapabilityId)
+	assert.Len(t, envelope.MessageId, 36)
+	assert.Equal(t, "sandbox-abcd", string(msg.Key))
+	assert.Equal(t, envelope.MessageId, headerValue(msg.Headers, HeaderMessageId))
+	assert.Equal(t, "value", headerValue(msg.Headers, "x-extra"))
+	assert.Equal(t, "correlation-1", headerValue(msg.Headers, HeaderCorrelationId))
+
+	msg, err = p.eventMessage(ctx, "", "capability_created", "1", capabilityCreated{}, []PublishOption{WithMessageId("message-1"), WithCorrelationId("correlation-2")})
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg.Value, &envelope))
+	assert.Equal(t, "message-1", envelope.MessageId)
+	assert.Equal(t, "correlation-2", envelope.XCorrelationId)
+
+	// A new correlation ID is generated if the context doesn't carry one
+	msg, err = p.eventMessage(context.Background(), "", "capability_created", "1", capabilityCreated{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg.Value, &envelope))
+	assert.Len(t, envelope.XCorrelationId, 36)
+	assert.Equal(t, envelope.XCorrelationId, headerValue(msg.Headers, HeaderCorrelationId))
+}
+
+func TestPublisher_Completion(t *testing.T) {
+	p := NewPublisher(AuthConfig{}, nil, zap.NewNop(), context.Background())
+
+	var reported Delivery
+	p.deliveries.Store("message-1", DeliveryCallback(func(delivery Delivery, err error) {
+		reported = delivery
+	}))
+
+	now := time.Now()
+	p.completion([]kafka.Message{
+		{Topic: "topic", Partition: 3, Offset: 41},
+		{Topic: "topic", Partition: 3, Offset: 42, Time: now, Headers: []kafka.Header{{Key: HeaderMessageId, Value: []byte("message-1")}}},
+	}, nil)
+
+	assert.Equal(t, Delivery{MessageId: "message-1", Topic: "topic", Partition: 3, Offset: 42, Timestamp: now}, reported)
+	_, exists := p.deliveries.Load("message-1")
+	assert.False(t, exists)
+}
+
+// unreportedBroker is a Broker whose writers don't report deliveries.
+type unreportedBroker struct {
+	*testBroker
+}
+
+func (b unreportedBroker) NewWriter(writer *kafka.Writer) MessageWriter {
+	return &testWriter{broker: b.testBroker, topic: writer.Topic}
+}
+
+func TestPublisher_PublishEventDelivery(t *testing.T) {
+	broker := newTestBroker()
+	p := NewPublisherWithBroker(broker, AuthConfig{}, nil, zap.NewNop(), context.Background())
+	delivery, err := PublishEvent(context.Background(), p, "topic", "key", "capability_created", "1", capabilityCreated{}, WithMessageId("message-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "message-1", delivery.MessageId)
+	assert.Equal(t, "topic", delivery.Topic)
+	assert.Equal(t, 0, delivery.Partition)
+
+	p = NewPublisherWithBroker(unreportedBroker{broker}, AuthConfig{}, nil, zap.NewNop(), context.Background())
+	delivery, err = PublishEvent(context.Background(), p, "topic", "key", "capability_created", "1", capabilityCreated{}, WithMessageId("message-2"))
+	assert.NoError(t, err)
+	assert.Equal(t, Delivery{MessageId: "message-2", Topic: "topic", Partition: -1, Offset: -1}, delivery)
+	assert.Len(t, broker.Written("topic"), 2)
+}
@@ -15,61 +15,119 @@ import (
 	"go.uber.org/zap"
 )
 
-func newConsumer(topic string, groupId string, authConfig AuthConfig, dialer *kafka.Dialer) *kafka.Reader {
-	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers: authConfig.Brokers,
-		GroupID: groupId,
-		Topic:   topic,
-		Dialer:  dialer,
+func newConsumer(broker Broker, topic string, groupId string, authConfig AuthConfig, dialer *kafka.Dialer) MessageReader {
+	// The start offset has been validated by NewDialer
+	startOffset, _ := authConfig.Reader.startOffset()
+
+	return broker.NewReader(kafka.ReaderConfig{
+		Brokers:       authConfig.Brokers,
+		GroupID:       groupId,
+		Topic:         topic,
+		Dialer:        dialer,
+		MinBytes:      authConfig.Reader.MinBytes,
+		MaxBytes:      authConfig.Reader.MaxBytes,
+		MaxWait:       authConfig.Reader.MaxWait,
+		StartOffset:   startOffset,
+		QueueCapacity: authConfig.Reader.QueueCapacity,
 	})
 }
 
 func NewConsumer(topic string, groupId string, authConfig AuthConfig, dialer *kafka.Dialer, logger *zap.Logger, wg *sync.WaitGroup, ctx context.Context) *Consumer {
+	return NewConsumerWithBroker(NewKafkaBroker(), topic, groupId, authConfig, dialer, logger, wg, ctx)
+}
+
+// NewConsumerWithBroker creates a Consumer reading from, and publishing to, broker.
+func NewConsumerWithBroker(broker Broker, topic string, groupId string, authConfig AuthConfig, dialer *kafka.Dialer, logger *zap.Logger, wg *sync.WaitGroup, ctx context.Context) *Consumer {
+	reader := newConsumer(broker, topic, groupId, authConfig, dialer)
+	kafkaReader, _ := reader.(*kafka.Reader)
+
 	return &Consumer{
-		topic:      topic,
-		groupId:    groupId,
-		Reader:     newConsumer(topic, groupId, authConfig, dialer),
-		registry:   registry.NewRegistry(),
-		logger:     logger,
-		wg:         wg,
-		ctx:        ctx,
-		authConfig: authConfig,
-		dialer:     dialer,
+		topic:        topic,
+		groupId:      groupId,
+		broker:       broker,
+		Reader:       kafkaReader,
+		reader:       reader,
+		registry:     registry.NewRegistry(),
+		logger:       logger,
+		wg:           wg,
+		ctx:          ctx,
+		authConfig:   authConfig,
+		dialer:       dialer,
+		retryPolicy:  DefaultRetryPolicy(),
+		commitConfig: DefaultCommitConfig(),
+		concurrency:  DefaultConcurrencyConfig(),
+		publisher:    NewPublisherWithBroker(broker, authConfig, dialer, logger, ctx),
+		sourceTopic:  topic,
 	}
 }
 
 type Consumer struct {
-	topic      string
-	groupId    string
-	authConfig AuthConfig
-	dialer     *kafka.Dialer
-	ctx        context.Context
-	registry   *registry.Registry
-	Reader     *kafka.Reader
-	logger     *zap.Logger
-	wg         *sync.WaitGroup
+	topic        string
+	groupId      string
+	authConfig   AuthConfig
+	dialer       *kafka.Dialer
+	broker       Broker
+	ctx          context.Context
+	registry     *registry.Registry
+	logger       *zap.Logger
+	wg           *sync.WaitGroup
+	retryPolicy  RetryPolicy
+	commitConfig CommitConfig
+	concurrency  ConcurrencyConfig
+
+	// Reader is the reader messages are consumed through, nil if the consumer reads from another Broker than Kafka.
+	Reader *kafka.Reader
+	reader MessageReader
+
+	publisher     *Publisher
+	deadLetter    *DeadLetterConfig
+	deduplication DeduplicationStore
+	retryTopics   *RetryTopicsConfig
+	// retryLevel is set for companion consumers reading from retry topics, sourceTopic is the topic they retry.
+	retryLevel  int
+	sourceTopic string
 }
 
 func (c *Consumer) Topic() string {
 	return c.topic
 }
 
-func (c *Consumer) Register(eventName string, f registry.HandlerFunc) {
-	c.registry.Register(eventName, f)
+// SetRetryPolicy sets the policy used to retry failing handlers before the consumer gives up on a message.
+func (c *Consumer) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// Register registers f as the handler for eventName. middlewares are only applied to this event.
+func (c *Consumer) Register(eventName string, f registry.HandlerFunc, middlewares ...registry.Middleware) {
+	c.registry.Register(eventName, f, middlewares...)
+}
+
+// Use adds middlewares applied to the handlers of all events.
+func (c *Consumer) Use(middlewares ...registry.Middleware) {
+	c.registry.Use(middlewares...)
 }
 
 func (c *Consumer) StartConsumer(initialHandlerContext *model.HandlerContext) {
 	var cleanupOnce sync.Once
-	partitionOffsetTracker := make(map[int]int64)
+	committer := newOffsetCommitter(c.reader, c.commitConfig, c.logger)
+	committer.Start(c.ctx)
 	cleanup := func() {
 		c.logger.Debug("Closing Kafka consumer")
-		if err := c.Reader.Close(); err != nil {
-			c.logger.Fatal("Failed to close Kafka consumer", zap.Error(err))
+
+		// The consumer context is likely cancelled at this point, so flushing offsets gets a context of its own
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := committer.Stop(ctx); err != nil {
+			c.logger.Error("Unable to commit offsets for consumer group", zap.Error(err))
 		}
 
-		offsets := make(map[string]map[int]int64)
-		offsets[c.topic] = partitionOffsetTracker
-		c.UpdateOffsets(offsets)
+		if err := c.publisher.Close(); err != nil {
+			c.logger.Error("Unable to close Kafka publisher", zap.Error(err))
+		}
+
+		if err := c.reader.Close(); err != nil {
+			c.logger.Fatal("Failed to close Kafka consumer", zap.Error(err))
+		}
 
 		c.logger.Debug("Kafka consumer has been closed")
 
@@ -79,103 +137,175 @@ func (c *Consumer) StartConsumer(initialHandlerContext *model.HandlerContext) {
 	c.wg.Add(1)
 	defer c.wg.Done()
 
+	var err error
+	if c.concurrency.Enabled {
+		err = c.consumeConcurrently(committer, initialHandlerContext)
+	} else {
+		err = c.consume(committer, initialHandlerContext)
+	}
+
+	cleanupOnce.Do(cleanup)
+	if err != nil && !strings.Contains(err.Error(), context.Canceled.Error()) {
+		log.Fatal(err)
+	}
+}
+
+// consume processes messages one at a time until the consumer is stopped. An error is returned if a message
+// couldn't be processed.
+func (c *Consumer) consume(committer *offsetCommitter, initialHandlerContext *model.HandlerContext) error {
 	for {
-		c.logger.Debug("Awaiting new message from topic")
-		msg, err := c.Reader.FetchMessage(c.ctx)
-		if err == io.EOF {
-			c.logger.Info("Connection closed")
-			break
-		} else if err == context.Canceled {
-			c.logger.Info("Processing canceled")
-			break
-		} else if err != nil {
-			c.logger.Error("Error fetching message", zap.Error(err))
-			break
-		}
-		msgLog := c.logger.With(zap.String("topic", msg.Topic),
-			zap.Int("partition", msg.Partition),
-			zap.Int64("offset", msg.Offset),
-			zap.String("key", string(msg.Key)),
-			zap.String("value", string(msg.Value)))
-		msgLog.Debug("Message fetched")
-
-		// Convert msg to Event
-		var handler registry.HandlerFunc
-		var eventLog *zap.Logger
-
-		event, err := GetEventFromMsg(msg.Value)
+		msg, err := c.fetchMessage(c.ctx)
 		if err != nil {
-			msgLog.Info("Unable to deserialise message payload. Quite likely the message is not valid JSON. Skipping message")
-			partitionOffsetTracker[msg.Partition] = msg.Offset + 1
-			offsets := make(map[string]map[int]int64)
-			offsets[c.topic] = partitionOffsetTracker
-			c.UpdateOffsets(offsets)
-			continue
+			return nil
 		}
 
-		if event == nil || (event.Type == "" && event.EventName == "") {
-			msgLog.Info("Unable to recognise event envelope, skipping message")
-			partitionOffsetTracker[msg.Partition] = msg.Offset + 1
-			offsets := make(map[string]map[int]int64)
-			offsets[c.topic] = partitionOffsetTracker
-			c.UpdateOffsets(offsets)
-			continue
+		if c.retryLevel > 0 && !c.waitUntilDue(c.ctx, msg) {
+			c.logger.Info("Processing canceled")
+			return nil
 		}
 
-		eventLog = c.logger.With(zap.String("topic", msg.Topic),
-			zap.Int("partition", msg.Partition),
-			zap.Int64("offset", msg.Offset),
-			zap.String("key", string(msg.Key)),
-			zap.String("eventName", event.Type))
-
-		handlerType := ""
-		if event.Type != "" {
-			handlerType = event.Type
-		} else {
-			handlerType = event.EventName
+		err = c.processMessage(msg, initialHandlerContext)
+		if err != nil {
+			return err
 		}
 
-		handler = c.registry.GetHandler(handlerType)
-		if handler == nil {
-			eventLog.Info("No handler registered for event, skipping.")
-			partitionOffsetTracker[msg.Partition] = msg.Offset + 1
-			offsets := make(map[string]map[int]int64)
-			offsets[c.topic] = partitionOffsetTracker
-			c.UpdateOffsets(offsets)
-			continue
-		}
+		committer.MarkProcessed(c.ctx, msg)
+	}
+}
+
+// fetchMessage fetches the next message. An error is returned once there are no more messages to fetch.
+func (c *Consumer) fetchMessage(ctx context.Context) (kafka.Message, error) {
+	c.logger.Debug("Awaiting new message from topic")
+	msg, err := c.reader.FetchMessage(ctx)
+	if err == io.EOF {
+		c.logger.Info("Connection closed")
+	} else if err == context.Canceled {
+		c.logger.Info("Processing canceled")
+	} else if err != nil {
+		c.logger.Error("Error fetching message", zap.Error(err))
+	}
+	return msg, err
+}
+
+// processMessage hands msg to its handler. Messages that can't be handled are skipped, forwarded to a retry topic
+// or published to the dead-letter topic. An error is only returned if the consumer should stop.
+func (c *Consumer) processMessage(msg kafka.Message, initialHandlerContext *model.HandlerContext) error {
+	msgLog := c.logger.With(zap.String("topic", msg.Topic),
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.String("key", string(msg.Key)),
+		zap.String("value", string(msg.Value)))
+	msgLog.Debug("Message fetched")
+
+	// Convert msg to Event
+	event, err := GetEventFromMsg(msg.Value)
+	if err != nil {
+		msgLog.Info("Unable to deserialise message payload. Quite likely the message is not valid JSON. Skipping message")
+		return c.deadLetterInvalid(msg, DeadLetterReasonInvalidJson, err, msgLog)
+	}
+
+	if event == nil || (event.Type == "" && event.EventName == "") {
+		msgLog.Info("Unable to recognise event envelope, skipping message")
+		return c.deadLetterInvalid(msg, DeadLetterReasonUnknownEnvelope, nil, msgLog)
+	}
 
-		var handlerContext model.HandlerContext
-		handlerContext.Event = event
-		handlerContext.Msg = msg.Value
+	correlationId := correlationIdOf(event, msg)
+	eventLog := c.logger.With(zap.String("topic", msg.Topic),
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.String("key", string(msg.Key)),
+		zap.String("eventName", event.Type),
+		zap.String("correlationId", correlationId))
+
+	handlerType := ""
+	if event.Type != "" {
+		handlerType = event.Type
+	} else {
+		handlerType = event.EventName
+	}
+
+	handler := c.registry.GetHandler(handlerType)
+	if handler == nil {
+		eventLog.Info("No handler registered for event, skipping.")
+		return nil
+	}
 
-		if initialHandlerContext != nil {
-			handlerContext.Writer = initialHandlerContext.Writer
+	var handlerContext model.HandlerContext
+	handlerContext.Event = event
+	handlerContext.Msg = msg.Value
+	handlerContext.Topic = msg.Topic
+	handlerContext.Partition = msg.Partition
+	handlerContext.Offset = msg.Offset
+	handlerContext.Key = msg.Key
+	handlerContext.Headers = msg.Headers
+	handlerContext.Timestamp = msg.Time
+	handlerContext.CorrelationId = correlationId
+	handlerContext.Publish = c.publisher.PublishContext
+
+	if initialHandlerContext != nil {
+		handlerContext.Writer = initialHandlerContext.Writer
+	}
+
+	ctx := ContextWithCorrelationId(c.ctx, correlationId)
+	attempts, err := c.retryPolicy.Run(ctx, func(attempt int) error {
+		if attempt > 1 {
+			eventLog.Warn("Retrying handler for event", zap.Int("attempt", attempt))
 		}
+		return c.handle(ctx, handler, handlerContext, eventLog)
+	})
+	if err == nil {
+		return nil
+	}
 
-		err = handler(c.ctx, handlerContext)
-		if err != nil {
-			eventLog.Error("Handler for event failed", zap.Error(err))
-			cleanupOnce.Do(cleanup)
-			if strings.Contains(err.Error(), context.Canceled.Error()) {
-				eventLog.Error("handler context canceled")
-				break
-			} else {
-				log.Fatal(err)
-			}
+	eventLog.Error("Handler for event failed", zap.Int("attempts", attempts), zap.Error(err))
+	if strings.Contains(err.Error(), context.Canceled.Error()) {
+		eventLog.Error("handler context canceled")
+		return err
+	}
+
+	return c.giveUp(msg, handlerType, attempts, err, eventLog)
+}
+
+// giveUp forwards a message whose handler keeps failing to the next retry topic, or the dead-letter topic once
+// there are no more retry topics or the error isn't retryable. cause is returned if neither is enabled or publishing
+// fails, except for poison messages, which are skipped if no dead-letter topic is enabled.
+func (c *Consumer) giveUp(msg kafka.Message, handlerType string, attempts int, cause error, eventLog *zap.Logger) error {
+	if topic, delay, ok := c.nextRetryTopic(); ok && IsRetryable(cause) {
+		err := c.publishRetry(msg, topic, delay, cause)
+		if err == nil {
+			eventLog.Warn("Message forwarded to retry topic", zap.String("retryTopic", topic), zap.Duration("delay", delay))
+			return nil
 		}
+		eventLog.Error("Unable to publish message to retry topic", zap.String("retryTopic", topic), zap.Error(err))
+	}
 
-		partitionOffsetTracker[msg.Partition] = msg.Offset + 1
+	if c.deadLetter != nil {
+		reason := DeadLetterReasonHandlerFailed
+		if IsPoisonMessage(cause) {
+			reason = DeadLetterReasonInvalidPayload
+		}
 
-		offsets := make(map[string]map[int]int64)
-		offsets[c.topic] = partitionOffsetTracker
+		err := c.publishDeadLetter(msg, reason, handlerType, attempts, cause)
+		if err == nil {
+			eventLog.Warn("Message published to dead-letter topic", zap.String("deadLetterTopic", c.deadLetter.Topic))
+			return nil
+		}
+		eventLog.Error("Unable to publish message to dead-letter topic", zap.Error(err))
+		return cause
+	}
 
-		c.UpdateOffsets(offsets)
+	if IsPoisonMessage(cause) {
+		// Stopping wouldn't help, as the message can never be handled, so it is skipped to keep the partition going
+		eventLog.Error("Skipping poison message, as no dead-letter topic is enabled")
+		return nil
 	}
 
-	cleanupOnce.Do(cleanup)
+	return cause
 }
 
+// UpdateOffsets commits offsets through a new consumer group.
+//
+// Deprecated: StartConsumer commits offsets through the consumer group session of Reader, see CommitConfig.
 func (c *Consumer) UpdateOffsets(offsets map[string]map[int]int64) {
 	c.logger.Debug("Updating offsets")
 	cg, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
@@ -223,48 +353,3 @@ func commitMsg(ctx context.Context, msg kafka.Message, consumer *kafka.Reader, l
 
 	return nil
 }
-
-func NewPublisher(authConfig AuthConfig, dialer *kafka.Dialer, logger *zap.Logger, ctx context.Context) *Publisher {
-	return &Publisher{
-		authConfig: authConfig,
-		dialer:     dialer,
-		ctx:        ctx,
-		logger:     logger,
-	}
-}
-
-type Publisher struct {
-	authConfig AuthConfig
-	dialer     *kafka.Dialer
-	ctx        context.Context
-	logger     *zap.Logger
-}
-
-func (p *Publisher) newPublisher(topic string) *kafka.Writer {
-	transport := &kafka.Transport{
-		Dial:        p.dialer.DialFunc,
-		SASL:        p.dialer.SASLMechanism,
-		TLS:         p.dialer.TLS,
-		ClientID:    p.dialer.ClientID,
-		IdleTimeout: 9 * time.Minute,
-		MetadataTTL: 15 * time.Second,
-	}
-
-	writer := &kafka.Writer{
-		Transport: transport,
-		Topic:     topic,
-		Addr:      kafka.TCP(p.authConfig.Brokers...),
-	}
-
-	return writer
-}
-
-func (p *Publisher) Writer(topic string) *kafka.Writer {
-	return p.newPublisher(topic)
-}
-
-func (p *Publisher) Publish(topic string, msgs ...kafka.Message) error {
-	publisher := p.Writer(topic)
-	err := publisher.WriteMessages(p.ctx, msgs...)
-	return err
-}
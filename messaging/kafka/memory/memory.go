@@ -0,0 +1,411 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	kafka2 "go.dfds.cloud/messaging/kafka"
+)
+
+// Broker is an in-memory stand-in for Kafka, implementing kafka.Broker. It supports topics with partitions and
+// consumer groups committing offsets, so consumers and publishers can be tested without an actual cluster.
+// Topics are created with the default number of partitions when first used.
+type Broker struct {
+	mu                sync.Mutex
+	defaultPartitions int
+	topics            map[string]*topic
+	groups            map[groupKey]*group
+	sequence          int64
+	// changed is closed and replaced whenever messages are written or partitions are reassigned, waking up readers
+	changed chan struct{}
+}
+
+type topic struct {
+	partitions [][]entry
+	next       int
+}
+
+type entry struct {
+	msg      kafka.Message
+	sequence int64
+}
+
+type groupKey struct {
+	id    string
+	topic string
+}
+
+type group struct {
+	startOffset int64
+	members     []*reader
+	// committed holds the next offset to consume per partition, or -1 if nothing has been committed
+	committed []int64
+	position  []int64
+}
+
+func NewBroker(defaultPartitions int) *Broker {
+	if defaultPartitions < 1 {
+		defaultPartitions = 1
+	}
+	return &Broker{
+		defaultPartitions: defaultPartitions,
+		topics:            map[string]*topic{},
+		groups:            map[groupKey]*group{},
+		changed:           make(chan struct{}),
+	}
+}
+
+// CreateTopic creates topic with the given number of partitions, if it doesn't exist yet.
+func (b *Broker) CreateTopic(name string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topic(name, partitions)
+}
+
+func (b *Broker) topic(name string, partitions int) *topic {
+	t, exists := b.topics[name]
+	if !exists {
+		if partitions < 1 {
+			partitions = b.defaultPartitions
+		}
+		t = &topic{partitions: make([][]entry, partitions)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Produce writes msg to topic, returning it with its partition, offset and time set. Messages with a key are
+// assigned a partition based on the key, others are spread across partitions.
+func (b *Broker) Produce(topicName string, msg kafka.Message) kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topicName, 0)
+	partition := t.next % len(t.partitions)
+	if msg.Key != nil {
+		hash := fnv.New32a()
+		hash.Write(msg.Key)
+		partition = int(hash.Sum32() % uint32(len(t.partitions)))
+	} else {
+		t.next++
+	}
+
+	msg.Topic = topicName
+	msg.Partition = partition
+	msg.Offset = int64(len(t.partitions[partition]))
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	b.sequence++
+	t.partitions[partition] = append(t.partitions[partition], entry{msg: msg, sequence: b.sequence})
+	b.notify()
+
+	return msg
+}
+
+// Messages returns the messages written to topic, in the order they were written.
+func (b *Broker) Messages(topicName string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[topicName]
+	if !exists {
+		return nil
+	}
+
+	var entries []entry
+	for _, partition := range t.partitions {
+		entries = append(entries, partition...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].sequence < entries[j].sequence
+	})
+
+	msgs := make([]kafka.Message, 0, len(entries))
+	for _, e := range entries {
+		msgs = append(msgs, e.msg)
+	}
+	return msgs
+}
+
+// Groups returns the IDs of the consumer groups that have read from topic.
+func (b *Broker) Groups(topicName string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ids []string
+	for key := range b.groups {
+		if key.topic == topicName {
+			ids = append(ids, key.id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Committed reports whether groupId has committed msg, i.e. processed it.
+func (b *Broker) Committed(groupId string, msg kafka.Message) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, exists := b.groups[groupKey{id: groupId, topic: msg.Topic}]
+	if !exists || msg.Partition >= len(g.committed) {
+		return false
+	}
+	return g.committed[msg.Partition] > msg.Offset
+}
+
+// Lag returns the number of messages on topic that groupId has yet to commit.
+func (b *Broker) Lag(groupId string, topicName string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[topicName]
+	if !exists {
+		return 0
+	}
+	g, exists := b.groups[groupKey{id: groupId, topic: topicName}]
+	if !exists {
+		return 0
+	}
+
+	var lag int64
+	for partition, entries := range t.partitions {
+		lag += int64(len(entries)) - g.offset(partition, len(entries))
+	}
+	return lag
+}
+
+// offset returns the committed offset of partition, or the start offset of the group if nothing has been committed.
+func (g *group) offset(partition int, length int) int64 {
+	if g.committed[partition] >= 0 {
+		return g.committed[partition]
+	}
+	if g.startOffset == kafka.LastOffset {
+		return int64(length)
+	}
+	return 0
+}
+
+// rebalance reassigns the partitions of the group to its members. Uncommitted messages are delivered again,
+// as they would be by Kafka.
+func (g *group) rebalance(t *topic) {
+	for partition := range g.position {
+		g.position[partition] = g.offset(partition, len(t.partitions[partition]))
+	}
+}
+
+func (g *group) owner(partition int) *reader {
+	if len(g.members) == 0 {
+		return nil
+	}
+	return g.members[partition%len(g.members)]
+}
+
+func (b *Broker) NewReader(config kafka.ReaderConfig) kafka2.MessageReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(config.Topic, 0)
+	r := &reader{broker: b, topic: config.Topic}
+
+	if config.GroupID == "" {
+		// Readers without a group read a single partition, from the start offset
+		r.partition = config.Partition
+		if config.StartOffset == kafka.LastOffset {
+			r.offset = int64(len(t.partitions[r.partition]))
+		}
+		return r
+	}
+
+	key := groupKey{id: config.GroupID, topic: config.Topic}
+	g, exists := b.groups[key]
+	if !exists {
+		g = &group{
+			startOffset: config.StartOffset,
+			committed:   make([]int64, len(t.partitions)),
+			position:    make([]int64, len(t.partitions)),
+		}
+		for partition := range g.committed {
+			g.committed[partition] = -1
+		}
+		b.groups[key] = g
+	}
+
+	r.group = g
+	g.members = append(g.members, r)
+	g.rebalance(t)
+	b.notify()
+
+	return r
+}
+
+func (b *Broker) NewWriter(writer *kafka.Writer) kafka2.MessageWriter {
+	return &memoryWriter{broker: b, topic: writer.Topic, completion: writer.Completion}
+}
+
+type reader struct {
+	broker    *Broker
+	topic     string
+	group     *group
+	partition int
+	offset    int64
+	next      int
+	closed    bool
+}
+
+func (r *reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		r.broker.mu.Lock()
+		if r.closed {
+			r.broker.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+
+		msg, found := r.fetch()
+		changed := r.broker.changed
+		r.broker.mu.Unlock()
+
+		if found {
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// fetch returns the next message for the reader, if any. The broker must be locked.
+func (r *reader) fetch() (kafka.Message, bool) {
+	t := r.broker.topics[r.topic]
+
+	if r.group == nil {
+		entries := t.partitions[r.partition]
+		if r.offset >= int64(len(entries)) {
+			return kafka.Message{}, false
+		}
+		msg := entries[r.offset].msg
+		r.offset++
+		return msg, true
+	}
+
+	// Partitions are visited in turn, so one busy partition doesn't starve the others
+	for i := 0; i < len(t.partitions); i++ {
+		partition := (r.next + i) % len(t.partitions)
+		if r.group.owner(partition) != r || r.group.position[partition] >= int64(len(t.partitions[partition])) {
+			continue
+		}
+
+		msg := t.partitions[partition][r.group.position[partition]].msg
+		r.group.position[partition]++
+		r.next = partition + 1
+		return msg, true
+	}
+
+	return kafka.Message{}, false
+}
+
+func (r *reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	if r.group == nil {
+		return errors.New("unavailable when GroupID is not set")
+	}
+	if r.closed {
+		return io.ErrClosedPipe
+	}
+
+	for _, msg := range msgs {
+		if msg.Offset+1 > r.group.committed[msg.Partition] {
+			r.group.committed[msg.Partition] = msg.Offset + 1
+		}
+	}
+	r.broker.notify()
+
+	return nil
+}
+
+func (r *reader) Close() error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	if r.group != nil {
+		for i, member := range r.group.members {
+			if member == r {
+				r.group.members = append(r.group.members[:i], r.group.members[i+1:]...)
+				break
+			}
+		}
+		r.group.rebalance(r.broker.topics[r.topic])
+	}
+	r.broker.notify()
+
+	return nil
+}
+
+type memoryWriter struct {
+	broker     *Broker
+	topic      string
+	completion func(messages []kafka.Message, err error)
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (w *memoryWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return io.ErrClosedPipe
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	written := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		topicName := w.topic
+		if topicName == "" {
+			topicName = msg.Topic
+		}
+		if topicName == "" {
+			return errors.New("no topic set on writer or message")
+		}
+		written = append(written, w.broker.Produce(topicName, msg))
+	}
+
+	if w.completion != nil {
+		w.completion(written, nil)
+	}
+
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
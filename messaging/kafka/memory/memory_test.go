@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	kafka2 "go.dfds.cloud/messaging/kafka"
+)
+
+func fetch(t *testing.T, r kafka2.MessageReader) (kafka.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	return r.FetchMessage(ctx)
+}
+
+func TestBroker_ConsumerGroup(t *testing.T) {
+	b := NewBroker(2)
+	first := b.NewReader(kafka.ReaderConfig{Topic: "topic", GroupID: "group"})
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		b.Produce("topic", kafka.Message{Key: []byte(key), Value: []byte(key)})
+	}
+	assert.Equal(t, int64(4), b.Lag("group", "topic"))
+
+	var fetched []kafka.Message
+	for i := 0; i < 4; i++ {
+		msg, err := fetch(t, first)
+		assert.NoError(t, err)
+		fetched = append(fetched, msg)
+	}
+	_, err := fetch(t, first)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, first.CommitMessages(context.Background(), fetched[0]))
+	assert.True(t, b.Committed("group", fetched[0]))
+	assert.Equal(t, int64(3), b.Lag("group", "topic"))
+
+	// A new member takes over a partition, and uncommitted messages are delivered again
+	second := b.NewReader(kafka.ReaderConfig{Topic: "topic", GroupID: "group"})
+	redelivered := 0
+	for _, r := range []kafka2.MessageReader{first, second} {
+		for {
+			if _, err := fetch(t, r); err != nil {
+				break
+			}
+			redelivered++
+		}
+	}
+	assert.Equal(t, 3, redelivered)
+
+	assert.NoError(t, first.Close())
+	_, err = first.FetchMessage(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []string{"group"}, b.Groups("topic"))
+}
+
+func TestBroker_Writer(t *testing.T) {
+	b := NewBroker(1)
+
+	var completed []kafka.Message
+	w := b.NewWriter(&kafka.Writer{Topic: "topic", Completion: func(messages []kafka.Message, err error) {
+		assert.NoError(t, err)
+		completed = append(completed, messages...)
+	}})
+	assert.NoError(t, w.WriteMessages(context.Background(), kafka.Message{Value: []byte("1")}, kafka.Message{Value: []byte("2")}))
+
+	assert.Len(t, completed, 2)
+	assert.Equal(t, int64(1), completed[1].Offset)
+	assert.Equal(t, "topic", completed[1].Topic)
+	assert.Equal(t, completed, b.Messages("topic"))
+
+	// Readers without a group read from the start offset and can't commit
+	r := b.NewReader(kafka.ReaderConfig{Topic: "topic", StartOffset: kafka.LastOffset})
+	assert.NoError(t, w.WriteMessages(context.Background(), kafka.Message{Value: []byte("3")}))
+	msg, err := fetch(t, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", string(msg.Value))
+	assert.Error(t, r.CommitMessages(context.Background(), msg))
+
+	assert.NoError(t, w.Close())
+	assert.Error(t, w.WriteMessages(context.Background(), kafka.Message{Value: []byte("4")}))
+}
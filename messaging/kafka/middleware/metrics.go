@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.dfds.cloud/messaging/internal/metrics"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.dfds.cloud/messaging/kafka/registry"
+)
+
+// Metrics records how many events are handled, their outcome and how long handling takes, labelled by event name.
+// Calling Metrics more than once with the same registerer and namespace shares the same collectors.
+func Metrics(registerer prometheus.Registerer, namespace string) registry.Middleware {
+	handled := metrics.Register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "events_handled_total",
+		Help:      "How many times has {event_name} been handled, by {outcome}.",
+		Namespace: namespace,
+	}, []string{"event_name", "outcome"}))
+	duration := metrics.Register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:      "event_handler_duration_seconds",
+		Help:      "How long does it take to handle {event_name}.",
+		Namespace: namespace,
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"event_name"}))
+
+	return func(next registry.HandlerFunc) registry.HandlerFunc {
+		return func(ctx context.Context, event model.HandlerContext) error {
+			start := time.Now()
+			err := next(ctx, event)
+
+			outcome := "success"
+			if err != nil {
+				outcome = "failure"
+			}
+			handled.WithLabelValues(eventName(event), outcome).Inc()
+			duration.WithLabelValues(eventName(event)).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.dfds.cloud/messaging/kafka/registry"
+	"go.uber.org/zap"
+)
+
+// eventName returns the name of the event being handled, preferring the envelope type.
+func eventName(event model.HandlerContext) string {
+	if event.Event == nil {
+		return ""
+	}
+	if event.Event.Type != "" {
+		return event.Event.Type
+	}
+	return event.Event.EventName
+}
+
+// Recovery turns a panicking handler into an error, so the consumer can retry or dead-letter the message.
+func Recovery(logger *zap.Logger) registry.Middleware {
+	return func(next registry.HandlerFunc) registry.HandlerFunc {
+		return func(ctx context.Context, event model.HandlerContext) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("Handler for event panicked", zap.String("eventName", eventName(event)), zap.Any("panic", r), zap.ByteString("stack", debug.Stack()))
+					err = fmt.Errorf("handler for event %s panicked: %v", eventName(event), r)
+				}
+			}()
+
+			return next(ctx, event)
+		}
+	}
+}
+
+// Logging logs the outcome and duration of every handled event.
+func Logging(logger *zap.Logger) registry.Middleware {
+	return func(next registry.HandlerFunc) registry.HandlerFunc {
+		return func(ctx context.Context, event model.HandlerContext) error {
+			start := time.Now()
+			eventLog := logger.With(zap.String("eventName", eventName(event)))
+			if event.Event != nil {
+				eventLog = eventLog.With(zap.String("messageId", event.Event.MessageId))
+			}
+			if event.CorrelationId != "" {
+				eventLog = eventLog.With(zap.String("correlationId", event.CorrelationId))
+			}
+
+			eventLog.Debug("Handling event")
+			err := next(ctx, event)
+			if err != nil {
+				eventLog.Warn("Handling event failed", zap.Duration("duration", time.Since(start)), zap.Error(err))
+			} else {
+				eventLog.Debug("Event handled", zap.Duration("duration", time.Since(start)))
+			}
+
+			return err
+		}
+	}
+}
+
+// Timeout cancels the context of a handler that runs for longer than timeout.
+func Timeout(timeout time.Duration) registry.Middleware {
+	return func(next registry.HandlerFunc) registry.HandlerFunc {
+		return func(ctx context.Context, event model.HandlerContext) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, event)
+		}
+	}
+}
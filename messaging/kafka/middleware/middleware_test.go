@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/internal/metrics"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestRecovery(t *testing.T) {
+	handler := Recovery(zap.NewNop())(func(ctx context.Context, event model.HandlerContext) error {
+		panic("boom")
+	})
+
+	err := handler(context.Background(), model.HandlerContext{Event: &model.Envelope{Type: "test-event"}})
+	assert.ErrorContains(t, err, "boom")
+}
+
+func TestTracing(t *testing.T) {
+	var spanContext trace.SpanContext
+	handler := Tracing()(func(ctx context.Context, event model.HandlerContext) error {
+		spanContext = trace.SpanContextFromContext(ctx)
+		return nil
+	})
+
+	event := model.HandlerContext{
+		Event:   &model.Envelope{Type: "test-event"},
+		Headers: []kafka.Header{{Key: "traceparent", Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")}},
+	}
+	assert.NoError(t, handler(context.Background(), event))
+
+	// The span joins the trace of the producer
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+}
+
+func TestMetrics(t *testing.T) {
+	registerer := prometheus.NewRegistry()
+	failing := Metrics(registerer, "test")(func(ctx context.Context, event model.HandlerContext) error {
+		return errors.New("failed")
+	})
+	succeeding := Metrics(registerer, "test")(func(ctx context.Context, event model.HandlerContext) error {
+		return nil
+	})
+
+	event := model.HandlerContext{Event: &model.Envelope{Type: "test-event"}}
+	assert.Error(t, failing(context.Background(), event))
+	assert.NoError(t, succeeding(context.Background(), event))
+	assert.NoError(t, succeeding(context.Background(), event))
+
+	handled := metrics.Register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "events_handled_total",
+		Help:      "How many times has {event_name} been handled, by {outcome}.",
+		Namespace: "test",
+	}, []string{"event_name", "outcome"}))
+	assert.Equal(t, 1.0, testutil.ToFloat64(handled.WithLabelValues("test-event", "failure")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(handled.WithLabelValues("test-event", "success")))
+}
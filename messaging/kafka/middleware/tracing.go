@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.dfds.cloud/messaging/kafka/registry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "go.dfds.cloud/messaging"
+
+// Tracing starts a consumer span for every handled event, using the global TracerProvider. The span is a child of
+// the span the message was published in, if the message carries a W3C traceparent header.
+func Tracing() registry.Middleware {
+	return func(next registry.HandlerFunc) registry.HandlerFunc {
+		return func(ctx context.Context, event model.HandlerContext) error {
+			attributes := []attribute.KeyValue{
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.event_name", eventName(event)),
+				attribute.String("messaging.destination.name", event.Topic),
+				attribute.Int("messaging.kafka.destination.partition", event.Partition),
+				attribute.Int64("messaging.kafka.message.offset", event.Offset),
+			}
+			if event.Event != nil {
+				attributes = append(attributes, attribute.String("messaging.message.id", event.Event.MessageId))
+			}
+
+			ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(event.HeaderMap()))
+			ctx, span := otel.Tracer(tracerName).Start(ctx, "handle "+eventName(event), trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attributes...))
+			defer span.End()
+
+			err := next(ctx, event)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return err
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package model
 
-import "github.com/segmentio/kafka-go"
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
 
 type Envelope struct {
 	Type           string `json:"type"`
@@ -22,9 +27,58 @@ type EnvelopeWithPayload[T any] struct {
 }
 
 type HandlerContext struct {
-	Event  *Envelope
-	Msg    []byte
+	Event *Envelope
+	Msg   []byte
+	// Writer is taken from the handler context the consumer was started with. Messages written with it aren't
+	// stamped with the correlation ID, so prefer Publish.
 	Writer NewWriterFunc
+	// Publish publishes messages through the consumer. Called with the context passed to the handler, the messages
+	// are stamped with the correlation ID of the message being handled.
+	Publish PublishFunc
+
+	// Metadata of the Kafka message the event was read from
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Headers   []kafka.Header
+	Timestamp time.Time
+
+	// CorrelationId is taken from the envelope or the message headers, or generated if neither has one.
+	// It is also carried by the context passed to the handler, so events published with it are correlated.
+	CorrelationId string
+}
+
+// Header returns the value of the first header named key, and whether the message has such a header.
+func (hc HandlerContext) Header(key string) (string, bool) {
+	for _, header := range hc.Headers {
+		if header.Key == key {
+			return string(header.Value), true
+		}
+	}
+	return "", false
+}
+
+// HeaderValues returns the values of all headers named key, in the order they appear on the message.
+func (hc HandlerContext) HeaderValues(key string) []string {
+	var values []string
+	for _, header := range hc.Headers {
+		if header.Key == key {
+			values = append(values, string(header.Value))
+		}
+	}
+	return values
+}
+
+// HeaderMap returns the headers of the message as a map. For repeated headers, the last value wins.
+func (hc HandlerContext) HeaderMap() map[string]string {
+	headers := make(map[string]string, len(hc.Headers))
+	for _, header := range hc.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	return headers
 }
 
 type NewWriterFunc func(topic string) *kafka.Writer
+
+type PublishFunc func(ctx context.Context, topic string, msgs ...kafka.Message) error
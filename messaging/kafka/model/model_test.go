@@ -0,0 +1,28 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerContext_Headers(t *testing.T) {
+	hc := HandlerContext{
+		Headers: []kafka.Header{
+			{Key: "x-sender", Value: []byte("capability-service")},
+			{Key: "x-tag", Value: []byte("a")},
+			{Key: "x-tag", Value: []byte("b")},
+		},
+	}
+
+	value, exists := hc.Header("x-sender")
+	assert.True(t, exists)
+	assert.Equal(t, "capability-service", value)
+
+	_, exists = hc.Header("x-missing")
+	assert.False(t, exists)
+
+	assert.Equal(t, []string{"a", "b"}, hc.HeaderValues("x-tag"))
+	assert.Equal(t, map[string]string{"x-sender": "capability-service", "x-tag": "b"}, hc.HeaderMap())
+}
@@ -0,0 +1,119 @@
+package oauthbearer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go/sasl"
+)
+
+// Token is an OAuth access token. A zero Expiry means the token doesn't expire.
+type Token struct {
+	Value  string
+	Expiry time.Time
+}
+
+// TokenSource provides the tokens used to authenticate with the brokers.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// Mechanism implements the OAUTHBEARER SASL mechanism (RFC 7628), authenticating with tokens from Source.
+type Mechanism struct {
+	Source TokenSource
+	// Extensions are sent along with the token, e.g. logicalCluster and identityPoolId for Confluent Cloud.
+	Extensions map[string]string
+}
+
+func (Mechanism) Name() string {
+	return "OAUTHBEARER"
+}
+
+func (m Mechanism) Start(ctx context.Context) (sasl.StateMachine, []byte, error) {
+	token, err := m.Source.Token(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get token for OAUTHBEARER authentication: %w", err)
+	}
+	if token.Value == "" {
+		return nil, nil, errors.New("unable to get token for OAUTHBEARER authentication: token is empty")
+	}
+
+	return m, initialResponse(token.Value, m.Extensions), nil
+}
+
+func (m Mechanism) Next(ctx context.Context, challenge []byte) (bool, []byte, error) {
+	// The broker only sends a challenge if it rejected the token, in which case it describes the error
+	if len(challenge) > 0 {
+		return true, nil, fmt.Errorf("OAUTHBEARER authentication failed: %s", challenge)
+	}
+	return true, nil, nil
+}
+
+func initialResponse(token string, extensions map[string]string) []byte {
+	keys := make([]string, 0, len(extensions))
+	for key := range extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString("n,,\x01auth=Bearer ")
+	builder.WriteString(token)
+	builder.WriteString("\x01")
+	for _, key := range keys {
+		builder.WriteString(key)
+		builder.WriteString("=")
+		builder.WriteString(extensions[key])
+		builder.WriteString("\x01")
+	}
+	builder.WriteString("\x01")
+
+	return []byte(builder.String())
+}
+
+// StaticTokenSource always returns the same token.
+type StaticTokenSource struct {
+	Value string
+}
+
+func (s StaticTokenSource) Token(ctx context.Context) (Token, error) {
+	return Token{Value: s.Value}, nil
+}
+
+// CachingTokenSource returns the token of Source until it is about to expire, only then getting a new one.
+type CachingTokenSource struct {
+	mu            sync.Mutex
+	source        TokenSource
+	refreshBefore time.Duration
+	token         Token
+}
+
+// NewCachingTokenSource caches the tokens of source, getting a new token refreshBefore the current one expires.
+func NewCachingTokenSource(source TokenSource, refreshBefore time.Duration) *CachingTokenSource {
+	return &CachingTokenSource{
+		source:        source,
+		refreshBefore: refreshBefore,
+	}
+}
+
+func (s *CachingTokenSource) Token(ctx context.Context) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Value != "" && (s.token.Expiry.IsZero() || time.Until(s.token.Expiry) > s.refreshBefore) {
+		return s.token, nil
+	}
+
+	token, err := s.source.Token(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	s.token = token
+
+	return token, nil
+}
@@ -0,0 +1,113 @@
+package oauthbearer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "kafka", r.PostForm.Get("scope"))
+
+		count := requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": %d}`, count, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	server, requests := newTokenServer(t, 3600)
+
+	source := ClientCredentialsTokenSource{TokenUrl: server.URL, ClientId: "client", ClientSecret: "secret", Scope: "kafka"}
+	token, err := source.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.Value)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+	assert.Equal(t, int32(1), requests.Load())
+
+	source.ClientSecret = "wrong"
+	_, err = source.Token(context.Background())
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestCachingTokenSource(t *testing.T) {
+	server, requests := newTokenServer(t, 3600)
+	source := NewCachingTokenSource(ClientCredentialsTokenSource{TokenUrl: server.URL, ClientId: "client", ClientSecret: "secret", Scope: "kafka"}, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", token.Value)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Tokens about to expire are refreshed
+	expiring, expiringRequests := newTokenServer(t, 30)
+	source = NewCachingTokenSource(ClientCredentialsTokenSource{TokenUrl: expiring.URL, ClientId: "client", ClientSecret: "secret", Scope: "kafka"}, time.Minute)
+	source.Token(context.Background())
+	token, err := source.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token.Value)
+	assert.Equal(t, int32(2), expiringRequests.Load())
+}
+
+func TestFileTokenSource(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub": "system:serviceaccount:default:app", "exp": %d}`, exp.Unix())))
+	jwt := "eyJhbGciOiJSUzI1NiJ9." + claims + ".signature"
+
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte(jwt+"\n"), 0600))
+
+	token, err := FileTokenSource{Path: path}.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, jwt, token.Value)
+	assert.True(t, exp.Equal(token.Expiry))
+
+	assert.NoError(t, os.WriteFile(path, []byte("opaque"), 0600))
+	token, err = FileTokenSource{Path: path}.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "opaque", token.Value)
+	assert.True(t, token.Expiry.IsZero())
+}
+
+func TestMechanism(t *testing.T) {
+	mechanism := Mechanism{
+		Source:     StaticTokenSource{Value: "abc"},
+		Extensions: map[string]string{"logicalCluster": "lkc-1", "identityPoolId": "pool-1"},
+	}
+	assert.Equal(t, "OAUTHBEARER", mechanism.Name())
+
+	session, response, err := mechanism.Start(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "n,,\x01auth=Bearer abc\x01identityPoolId=pool-1\x01logicalCluster=lkc-1\x01\x01", string(response))
+
+	done, _, err := session.Next(context.Background(), nil)
+	assert.True(t, done)
+	assert.NoError(t, err)
+
+	_, _, err = session.Next(context.Background(), []byte(`{"status":"invalid_token"}`))
+	assert.ErrorContains(t, err, "invalid_token")
+
+	_, _, err = Mechanism{Source: StaticTokenSource{}}.Start(context.Background())
+	assert.Error(t, err)
+}
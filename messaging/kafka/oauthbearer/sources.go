@@ -0,0 +1,119 @@
+package oauthbearer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ClientCredentialsTokenSource gets tokens from an OAuth token endpoint using the client credentials flow.
+type ClientCredentialsTokenSource struct {
+	Client       *http.Client
+	TokenUrl     string
+	ClientId     string
+	ClientSecret string
+	Scope        string
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (s ClientCredentialsTokenSource) Token(ctx context.Context) (Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", s.ClientId)
+	form.Set("client_secret", s.ClientSecret)
+	if s.Scope != "" {
+		form.Set("scope", s.Scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Token{}, fmt.Errorf("token endpoint returned status code %d: %s", resp.StatusCode, data)
+	}
+
+	var payload tokenResponse
+	err = json.Unmarshal(data, &payload)
+	if err != nil {
+		return Token{}, err
+	}
+	if payload.AccessToken == "" {
+		return Token{}, errors.New("token endpoint returned no access_token")
+	}
+
+	token := Token{Value: payload.AccessToken}
+	if payload.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// FileTokenSource reads the token from a file, e.g. a Kubernetes projected service account token. The file is
+// read on every call, so rotated tokens are picked up. The expiry is taken from the exp claim if the token is a JWT.
+type FileTokenSource struct {
+	Path string
+}
+
+func (s FileTokenSource) Token(ctx context.Context) (Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return Token{}, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	return Token{Value: value, Expiry: jwtExpiry(value)}, nil
+}
+
+// jwtExpiry returns the time of the exp claim of token, or the zero time if token isn't a JWT with an exp claim.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,185 @@
+// Package outbox implements the transactional outbox pattern for Kafka: messages are written to a database table
+// in the transaction of the changes they describe, and published afterwards by a Relay.
+//
+// It lives beside the other Kafka packages rather than in messaging, as it stores and publishes kafka.Message
+// values and reuses kafka.RetryPolicy, and keeps database/sql out of services that only consume or publish.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+var validTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Outbox stores messages in a database table, so they can be written in the same transaction as the changes
+// they describe. The messages are published to Kafka afterwards by a Relay.
+//
+// Queries use $n placeholders, as supported by PostgreSQL and SQLite.
+type Outbox struct {
+	table   string
+	dialect Dialect
+}
+
+func New(table string, dialect Dialect) (*Outbox, error) {
+	if !validTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	if dialect != DialectPostgres && dialect != DialectSQLite {
+		return nil, fmt.Errorf("unsupported dialect %q", dialect)
+	}
+	return &Outbox{table: table, dialect: dialect}, nil
+}
+
+// EnsureSchema creates the outbox table if it doesn't exist.
+func (o *Outbox) EnsureSchema(ctx context.Context, db *sql.DB) error {
+	id := "BIGSERIAL PRIMARY KEY"
+	binary := "BYTEA"
+	if o.dialect == DialectSQLite {
+		id = "INTEGER PRIMARY KEY AUTOINCREMENT"
+		binary = "BLOB"
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id %s,
+	topic VARCHAR(255) NOT NULL,
+	message_key %s,
+	payload %s NOT NULL,
+	headers TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	sent_at TIMESTAMP,
+	failed_at TIMESTAMP
+)`, o.table, id, binary, binary))
+	return err
+}
+
+// Add marshals envelope to JSON and stores it in the outbox within tx. It is only published once tx is committed.
+func (o *Outbox) Add(ctx context.Context, tx *sql.Tx, topic string, key string, envelope interface{}, headers ...kafka.Header) error {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return o.AddMessage(ctx, tx, topic, kafka.Message{
+		Key:     []byte(key),
+		Value:   payload,
+		Headers: headers,
+	})
+}
+
+// AddMessage stores msg in the outbox within tx. It is only published once tx is committed.
+func (o *Outbox) AddMessage(ctx context.Context, tx *sql.Tx, topic string, msg kafka.Message) error {
+	headers, err := marshalHeaders(msg.Headers)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (topic, message_key, payload, headers, created_at) VALUES ($1, $2, $3, $4, $5)", o.table),
+		topic, msg.Key, msg.Value, headers, time.Now().UTC())
+	return err
+}
+
+// Entry is a message stored in the outbox.
+type Entry struct {
+	Id        int64
+	Topic     string
+	Message   kafka.Message
+	CreatedAt time.Time
+	Attempts  int
+}
+
+// pending returns up to limit messages that have yet to be published, in the order they were added.
+func (o *Outbox) pending(ctx context.Context, db *sql.DB, limit int) ([]Entry, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT id, topic, message_key, payload, headers, created_at, attempts FROM %s WHERE sent_at IS NULL AND failed_at IS NULL ORDER BY id LIMIT $1", o.table), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var headers string
+		err = rows.Scan(&entry.Id, &entry.Topic, &entry.Message.Key, &entry.Message.Value, &headers, &entry.CreatedAt, &entry.Attempts)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Message.Headers, err = unmarshalHeaders(headers)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (o *Outbox) markSent(ctx context.Context, db *sql.DB, id int64) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET sent_at = $1, attempts = attempts + 1, last_error = NULL WHERE id = $2", o.table), time.Now().UTC(), id)
+	return err
+}
+
+// markFailed records a failed attempt at publishing a message. If giveUp is true, the message won't be attempted again.
+func (o *Outbox) markFailed(ctx context.Context, db *sql.DB, id int64, cause error, giveUp bool) error {
+	var failedAt interface{}
+	if giveUp {
+		failedAt = time.Now().UTC()
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = $1, failed_at = $2 WHERE id = $3", o.table), cause.Error(), failedAt, id)
+	return err
+}
+
+// Cleanup deletes messages published before olderThan, returning how many were deleted.
+func (o *Outbox) Cleanup(ctx context.Context, db *sql.DB, olderThan time.Time) (int64, error) {
+	result, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE sent_at IS NOT NULL AND sent_at < $1", o.table), olderThan.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func marshalHeaders(headers []kafka.Header) (string, error) {
+	payload := make([]header, 0, len(headers))
+	for _, h := range headers {
+		payload = append(payload, header{Key: h.Key, Value: h.Value})
+	}
+
+	data, err := json.Marshal(payload)
+	return string(data), err
+}
+
+func unmarshalHeaders(data string) ([]kafka.Header, error) {
+	var payload []header
+	err := json.Unmarshal([]byte(data), &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make([]kafka.Header, 0, len(payload))
+	for _, h := range payload {
+		headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	return headers, nil
+}
@@ -0,0 +1,193 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+type fakePublisher struct {
+	published []kafka.Message
+	calls     int
+	failures  int
+	ctx       context.Context
+}
+
+type relayKey struct{}
+
+func (p *fakePublisher) PublishContext(ctx context.Context, topic string, msgs ...kafka.Message) error {
+	p.calls++
+	p.ctx = ctx
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	for _, msg := range msgs {
+		msg.Topic = topic
+		p.published = append(p.published, msg)
+	}
+	return nil
+}
+
+func setupOutbox(t *testing.T) (*sql.DB, *Outbox) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	outbox, err := New("outbox", DialectSQLite)
+	assert.NoError(t, err)
+	assert.NoError(t, outbox.EnsureSchema(context.Background(), db))
+
+	return db, outbox
+}
+
+func addMessages(t *testing.T, db *sql.DB, outbox *Outbox, commit bool, ids ...string) {
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	for _, id := range ids {
+		err = outbox.Add(context.Background(), tx, "cloudengineering.selfservice.capability", id, map[string]string{"messageId": id}, kafka.Header{Key: "x-id", Value: []byte(id)})
+		assert.NoError(t, err)
+	}
+	if commit {
+		assert.NoError(t, tx.Commit())
+	} else {
+		assert.NoError(t, tx.Rollback())
+	}
+}
+
+func relayConfig(maxAttempts int) RelayConfig {
+	config := DefaultRelayConfig()
+	config.BatchSize = 2
+	config.MaxAttempts = maxAttempts
+	config.RetryPolicy.MaxAttempts = 1
+	return config
+}
+
+func TestRelay_Run(t *testing.T) {
+	db, outbox := setupOutbox(t)
+	addMessages(t, db, outbox, true, "1", "2", "3")
+	addMessages(t, db, outbox, false, "rolled-back")
+
+	publisher := &fakePublisher{}
+	relay := NewRelay(db, outbox, publisher, relayConfig(0), zap.NewNop())
+	assert.NoError(t, relay.Run(context.Background()))
+
+	assert.Len(t, publisher.published, 3)
+	for i, id := range []string{"1", "2", "3"} {
+		assert.Equal(t, "cloudengineering.selfservice.capability", publisher.published[i].Topic)
+		assert.Equal(t, id, string(publisher.published[i].Key))
+		assert.JSONEq(t, `{"messageId": "`+id+`"}`, string(publisher.published[i].Value))
+		assert.Equal(t, []kafka.Header{{Key: "x-id", Value: []byte(id)}}, publisher.published[i].Headers)
+	}
+
+	// Published messages aren't published again
+	assert.NoError(t, relay.Run(context.Background()))
+	assert.Len(t, publisher.published, 3)
+
+	deleted, err := outbox.Cleanup(context.Background(), db, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+}
+
+func TestRelay_RunGroupsTopics(t *testing.T) {
+	db, outbox := setupOutbox(t)
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	for i, topic := range []string{"capability", "capability", "member", "capability"} {
+		assert.NoError(t, outbox.Add(context.Background(), tx, "cloudengineering.selfservice."+topic, strconv.Itoa(i), struct{}{}))
+	}
+	assert.NoError(t, tx.Commit())
+
+	publisher := &fakePublisher{}
+	config := relayConfig(0)
+	config.BatchSize = 10
+	relay := NewRelay(db, outbox, publisher, config, zap.NewNop())
+	ctx := context.WithValue(context.Background(), relayKey{}, "run")
+	assert.NoError(t, relay.Run(ctx))
+
+	// Consecutive messages for the same topic are published at once, without changing the order
+	assert.Equal(t, 3, publisher.calls)
+	if assert.Len(t, publisher.published, 4) {
+		for i, msg := range publisher.published {
+			assert.Equal(t, strconv.Itoa(i), string(msg.Key))
+		}
+		assert.Equal(t, "cloudengineering.selfservice.member", publisher.published[2].Topic)
+	}
+
+	// The context of the run is passed on
+	assert.Equal(t, "run", publisher.ctx.Value(relayKey{}))
+}
+
+func TestRelay_RunKeepsOrderOnFailure(t *testing.T) {
+	db, outbox := setupOutbox(t)
+	addMessages(t, db, outbox, true, "1", "2")
+
+	publisher := &fakePublisher{failures: 1}
+	relay := NewRelay(db, outbox, publisher, relayConfig(0), zap.NewNop())
+	assert.Error(t, relay.Run(context.Background()))
+	assert.Empty(t, publisher.published)
+
+	assert.NoError(t, relay.Run(context.Background()))
+	assert.Len(t, publisher.published, 2)
+	assert.Equal(t, "1", string(publisher.published[0].Key))
+	assert.Equal(t, "2", string(publisher.published[1].Key))
+}
+
+func TestRelay_RunGivesUpAfterMaxAttempts(t *testing.T) {
+	db, outbox := setupOutbox(t)
+	addMessages(t, db, outbox, true, "1", "2")
+
+	publisher := &fakePublisher{failures: 2}
+	relay := NewRelay(db, outbox, publisher, relayConfig(2), zap.NewNop())
+	assert.Error(t, relay.Run(context.Background()))
+	assert.NoError(t, relay.Run(context.Background()))
+
+	assert.Len(t, publisher.published, 1)
+	assert.Equal(t, "2", string(publisher.published[0].Key))
+
+	var lastError string
+	err := db.QueryRow("SELECT last_error FROM outbox WHERE failed_at IS NOT NULL").Scan(&lastError)
+	assert.NoError(t, err)
+	assert.Equal(t, "broker unavailable", lastError)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("outbox; DROP TABLE x", DialectPostgres)
+	assert.Error(t, err)
+	_, err = New("outbox", "oracle")
+	assert.Error(t, err)
+}
+
+func TestNewRelay_ZeroConfig(t *testing.T) {
+	db, outbox := setupOutbox(t)
+	addMessages(t, db, outbox, true, "1", "2", "3")
+
+	publisher := &fakePublisher{}
+	relay := NewRelay(db, outbox, publisher, RelayConfig{}, zap.NewNop())
+	assert.Equal(t, DefaultRelayConfig().BatchSize, relay.config.BatchSize)
+	assert.Equal(t, DefaultRelayConfig().Interval, relay.config.Interval)
+	assert.Equal(t, DefaultRelayConfig().RetryPolicy.MaxAttempts, relay.config.RetryPolicy.MaxAttempts)
+
+	done := make(chan error)
+	go func() { done <- relay.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return")
+	}
+	assert.Len(t, publisher.published, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotPanics(t, func() { relay.Start(ctx) })
+}
@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	kafka2 "go.dfds.cloud/messaging/kafka"
+	"go.uber.org/zap"
+)
+
+// Publisher publishes messages to a topic. It is implemented by kafka.Publisher.
+type Publisher interface {
+	PublishContext(ctx context.Context, topic string, msgs ...kafka.Message) error
+}
+
+type RelayConfig struct {
+	// BatchSize is the number of messages read from the outbox at a time. 0 uses the default.
+	BatchSize int
+	// Interval is how often the outbox is checked for pending messages by Start. 0 uses the default.
+	Interval time.Duration
+	// MaxAttempts is the number of relay runs a message is attempted in before it is given up on and skipped.
+	// 0 keeps attempting the message, blocking the messages after it.
+	MaxAttempts int
+	// RetryPolicy decides how a message is retried within a single relay run. A policy without MaxAttempts uses the
+	// default.
+	RetryPolicy kafka2.RetryPolicy
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		BatchSize:   100,
+		Interval:    time.Second,
+		MaxAttempts: 0,
+		RetryPolicy: kafka2.DefaultRetryPolicy(),
+	}
+}
+
+// Relay publishes the messages of an Outbox in the order they were added. Only one relay should run per outbox
+// table, e.g. by running Run as an orchestrator job with job locking enabled.
+type Relay struct {
+	db        *sql.DB
+	outbox    *Outbox
+	publisher Publisher
+	config    RelayConfig
+	logger    *zap.Logger
+}
+
+func NewRelay(db *sql.DB, outbox *Outbox, publisher Publisher, config RelayConfig, logger *zap.Logger) *Relay {
+	defaults := DefaultRelayConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.RetryPolicy.MaxAttempts <= 0 {
+		config.RetryPolicy = defaults.RetryPolicy
+	}
+
+	return &Relay{
+		db:        db,
+		outbox:    outbox,
+		publisher: publisher,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+// Run publishes pending messages until there are none left. If a message can't be published, Run stops and
+// returns the error, so messages are never published out of order. Run can be used as an orchestrator job handler.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		entries, err := r.outbox.pending(ctx, r.db, r.config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for remaining := entries; len(remaining) > 0; {
+			batch := remaining[:1]
+			for len(batch) < len(remaining) && remaining[len(batch)].Topic == batch[0].Topic {
+				batch = remaining[:len(batch)+1]
+			}
+
+			handled, err := r.publish(ctx, batch)
+			if err != nil {
+				return err
+			}
+			remaining = remaining[handled:]
+		}
+
+		if len(entries) < r.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// publish publishes consecutive entries for the same topic at once, returning how many of them were dealt with. A
+// failure is recorded as a failed attempt at the first entry, as it holds up the others. If that entry is given up
+// on, the others are attempted again without it.
+func (r *Relay) publish(ctx context.Context, batch []Entry) (int, error) {
+	first := batch[0]
+	batchLog := r.logger.With(zap.Int64("outboxId", first.Id), zap.String("topic", first.Topic), zap.Int("messages", len(batch)))
+
+	msgs := make([]kafka.Message, 0, len(batch))
+	for _, entry := range batch {
+		msgs = append(msgs, entry.Message)
+	}
+
+	_, err := r.config.RetryPolicy.Run(ctx, func(attempt int) error {
+		if attempt > 1 {
+			batchLog.Warn("Retrying publishing outbox messages", zap.Int("attempt", attempt))
+		}
+		return r.publisher.PublishContext(ctx, first.Topic, msgs...)
+	})
+	if err == nil {
+		batchLog.Debug("Outbox messages published")
+		for _, entry := range batch {
+			if err := r.outbox.markSent(ctx, r.db, entry.Id); err != nil {
+				return 0, err
+			}
+		}
+		return len(batch), nil
+	}
+
+	giveUp := r.config.MaxAttempts > 0 && first.Attempts+1 >= r.config.MaxAttempts
+	if markErr := r.outbox.markFailed(ctx, r.db, first.Id, err, giveUp); markErr != nil {
+		batchLog.Error("Unable to record failed attempt at publishing outbox message", zap.Error(markErr))
+	}
+	if giveUp {
+		batchLog.Error("Unable to publish outbox message, giving up", zap.Int("attempts", first.Attempts+1), zap.Error(err))
+		return 1, nil
+	}
+
+	batchLog.Error("Unable to publish outbox message", zap.Int("attempts", first.Attempts+1), zap.Error(err))
+	return 0, err
+}
+
+// Start runs the relay every Interval until ctx is cancelled.
+func (r *Relay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Run(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("Outbox relay run failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+var ErrPublisherClosed = errors.New("publisher has been closed")
+
+// PublisherConfig tunes how messages are written. A batch is written once it holds BatchSize messages or
+// BatchBytes bytes, or BatchTimeout has passed, whichever comes first.
+type PublisherConfig struct {
+	BatchSize    int           `envconfig:"BATCH_SIZE" default:"100"`
+	BatchBytes   int64         `envconfig:"BATCH_BYTES" default:"1048576"`
+	BatchTimeout time.Duration `envconfig:"BATCH_TIMEOUT" default:"10ms"`
+	// Sender is set as x-sender on envelopes published with PublishEvent.
+	Sender string `envconfig:"SENDER"`
+	// Compression is the codec messages are compressed with, one of none, gzip, snappy, lz4 or zstd.
+	Compression kafka.Compression `envconfig:"COMPRESSION" default:"none"`
+	// WriteTimeout and ReadTimeout bound how long writing a batch and waiting for its acknowledgement may take.
+	WriteTimeout time.Duration `envconfig:"WRITE_TIMEOUT" default:"10s"`
+	ReadTimeout  time.Duration `envconfig:"READ_TIMEOUT" default:"10s"`
+	// MaxInFlight is the number of messages published asynchronously that may await delivery at a time.
+	// Publishing asynchronously blocks while the limit is reached.
+	MaxInFlight int `envconfig:"MAX_IN_FLIGHT" default:"1000"`
+}
+
+func DefaultPublisherConfig() PublisherConfig {
+	return PublisherConfig{
+		BatchSize:    100,
+		BatchBytes:   1048576,
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  10 * time.Second,
+		MaxInFlight:  1000,
+	}
+}
+
+func NewPublisher(authConfig AuthConfig, dialer *kafka.Dialer, logger *zap.Logger, ctx context.Context) *Publisher {
+	return NewPublisherWithBroker(NewKafkaBroker(), authConfig, dialer, logger, ctx)
+}
+
+// NewPublisherWithBroker creates a Publisher writing to broker.
+func NewPublisherWithBroker(broker Broker, authConfig AuthConfig, dialer *kafka.Dialer, logger *zap.Logger, ctx context.Context) *Publisher {
+	config := DefaultPublisherConfig()
+	return &Publisher{
+		broker:       broker,
+		authConfig:   authConfig,
+		dialer:       dialer,
+		ctx:          ctx,
+		logger:       logger,
+		config:       config,
+		transport:    newTransport(dialer),
+		writers:      map[string]MessageWriter{},
+		asyncWriters: map[string]MessageWriter{},
+		inFlight:     make(chan struct{}, config.MaxInFlight),
+	}
+}
+
+// Publisher publishes messages through a long-lived writer per topic, all sharing the same connections to the
+// brokers. Close must be called on shutdown to flush and release them.
+type Publisher struct {
+	broker     Broker
+	authConfig AuthConfig
+	dialer     *kafka.Dialer
+	ctx        context.Context
+	logger     *zap.Logger
+	config     PublisherConfig
+	transport  *kafka.Transport
+
+	mu           sync.Mutex
+	writers      map[string]MessageWriter
+	asyncWriters map[string]MessageWriter
+	closed       bool
+	// deliveries holds a DeliveryCallback per messageId of the messages awaiting a delivery report
+	deliveries sync.Map
+	// inFlight holds a slot per message published asynchronously that awaits delivery
+	inFlight chan struct{}
+	metrics  *publisherMetrics
+}
+
+func newTransport(dialer *kafka.Dialer) *kafka.Transport {
+	transport := &kafka.Transport{
+		IdleTimeout: 9 * time.Minute,
+		MetadataTTL: 15 * time.Second,
+	}
+	if dialer != nil {
+		transport.Dial = dialer.DialFunc
+		transport.SASL = dialer.SASLMechanism
+		transport.TLS = dialer.TLS
+		transport.ClientID = dialer.ClientID
+	}
+	return transport
+}
+
+// SetConfig sets how messages are written. It only affects writers created afterwards, so it should be called
+// before publishing.
+func (p *Publisher) SetConfig(config PublisherConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.config = config
+	if cap(p.inFlight) != config.MaxInFlight && config.MaxInFlight > 0 {
+		p.inFlight = make(chan struct{}, config.MaxInFlight)
+	}
+}
+
+// SetPublisherConfig sets how messages forwarded to retry and dead-letter topics, and published by handlers through
+// HandlerContext.Publish, are written.
+func (c *Consumer) SetPublisherConfig(config PublisherConfig) {
+	c.publisher.SetConfig(config)
+}
+
+// Publisher returns the publisher of the consumer, which is closed when the consumer stops.
+func (c *Consumer) Publisher() *Publisher {
+	return c.publisher
+}
+
+func (p *Publisher) newWriter(topic string, async bool) *kafka.Writer {
+	return &kafka.Writer{
+		Async:        async,
+		Transport:    p.transport,
+		Topic:        topic,
+		Addr:         kafka.TCP(p.authConfig.Brokers...),
+		BatchSize:    p.config.BatchSize,
+		BatchBytes:   p.config.BatchBytes,
+		BatchTimeout: p.config.BatchTimeout,
+		Compression:  p.config.Compression,
+		WriteTimeout: p.config.WriteTimeout,
+		ReadTimeout:  p.config.ReadTimeout,
+		Completion:   p.completion,
+	}
+}
+
+// Writer returns a new writer for topic, sharing the connections of the publisher. The caller is responsible
+// for closing it. The writer always talks to Kafka, even if the publisher was created with another Broker.
+func (p *Publisher) Writer(topic string) *kafka.Writer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.newWriter(topic, false)
+}
+
+// writer returns the pooled writer for topic, creating it if needed.
+func (p *Publisher) writer(topic string) (MessageWriter, error) {
+	return p.pooledWriter(p.writers, topic, false)
+}
+
+// asyncWriter returns the pooled asynchronous writer for topic, creating it if needed.
+func (p *Publisher) asyncWriter(topic string) (MessageWriter, error) {
+	return p.pooledWriter(p.asyncWriters, topic, true)
+}
+
+func (p *Publisher) pooledWriter(pool map[string]MessageWriter, topic string, async bool) (MessageWriter, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPublisherClosed
+	}
+
+	writer, exists := pool[topic]
+	if !exists {
+		writer = p.broker.NewWriter(p.newWriter(topic, async))
+		pool[topic] = writer
+	}
+
+	return writer, nil
+}
+
+// Publish publishes msgs to topic, stamping a new correlation ID on messages without an HeaderCorrelationId header.
+// Use PublishContext to publish from handlers instead, so the published messages are correlated.
+func (p *Publisher) Publish(topic string, msgs ...kafka.Message) error {
+	return p.PublishContext(p.ctx, topic, msgs...)
+}
+
+// PublishContext publishes msgs to topic, stamping the correlation ID carried by ctx, or a new one, on messages
+// without an HeaderCorrelationId header. Use it to publish from handlers, so the published messages are correlated
+// with the message being handled.
+func (p *Publisher) PublishContext(ctx context.Context, topic string, msgs ...kafka.Message) error {
+	writer, err := p.writer(topic)
+	if err != nil {
+		return err
+	}
+
+	correlationId := correlationIdFromContextOrNew(ctx)
+	stamped := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		if headerValue(msg.Headers, HeaderCorrelationId) == "" {
+			msg.Headers = append(append(make([]kafka.Header, 0, len(msg.Headers)+1), msg.Headers...), kafka.Header{Key: HeaderCorrelationId, Value: []byte(correlationId)})
+		}
+		stamped[i] = msg
+	}
+
+	return writer.WriteMessages(ctx, stamped...)
+}
+
+// Close flushes pending messages, closes all writers and releases the connections of the publisher. It waits for
+// the delivery reports of messages published asynchronously.
+// Publishing after Close returns ErrPublisherClosed.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	pools := []map[string]MessageWriter{p.writers, p.asyncWriters}
+	p.writers = map[string]MessageWriter{}
+	p.asyncWriters = map[string]MessageWriter{}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, writers := range pools {
+		for topic, writer := range writers {
+			if err := writer.Close(); err != nil {
+				p.logger.Error("Unable to close Kafka writer", zap.String("topic", topic), zap.Error(err))
+				errs = append(errs, err)
+			}
+		}
+	}
+	p.transport.CloseIdleConnections()
+
+	return errors.Join(errs...)
+}
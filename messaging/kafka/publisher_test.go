@@ -0,0 +1,35 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPublisher_WriterPool(t *testing.T) {
+	p := NewPublisher(AuthConfig{Brokers: []string{"localhost:9092"}}, nil, zap.NewNop(), context.Background())
+	config := DefaultPublisherConfig()
+	config.BatchSize = 10
+	config.Compression = kafka.Zstd
+	p.SetConfig(config)
+
+	first, err := p.writer("topic-a")
+	assert.NoError(t, err)
+	second, err := p.writer("topic-a")
+	assert.NoError(t, err)
+	other, err := p.writer("topic-b")
+	assert.NoError(t, err)
+
+	assert.Same(t, first, second)
+	assert.NotSame(t, first, other)
+	assert.Same(t, first.(*kafka.Writer).Transport, other.(*kafka.Writer).Transport)
+	assert.Equal(t, 10, first.(*kafka.Writer).BatchSize)
+	assert.Equal(t, kafka.Zstd, first.(*kafka.Writer).Compression)
+
+	assert.NoError(t, p.Close())
+	assert.NoError(t, p.Close())
+	assert.ErrorIs(t, p.Publish("topic-a", kafka.Message{Value: []byte("{}")}), ErrPublisherClosed)
+}
@@ -7,20 +7,70 @@ import (
 
 type HandlerFunc func(ctx context.Context, event model.HandlerContext) error
 
+// Middleware wraps a HandlerFunc, e.g. to add logging, metrics or panic recovery.
+type Middleware func(next HandlerFunc) HandlerFunc
+
 type Registry struct {
-	handlers map[string]HandlerFunc
+	handlers         map[string]HandlerFunc
+	middlewares      []Middleware
+	eventMiddlewares map[string][]Middleware
+	// chains holds the handlers wrapped in their middlewares, rebuilt whenever handlers or middlewares change
+	chains map[string]HandlerFunc
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
-		handlers: map[string]HandlerFunc{},
+		handlers:         map[string]HandlerFunc{},
+		eventMiddlewares: map[string][]Middleware{},
+		chains:           map[string]HandlerFunc{},
 	}
 }
 
-func (r *Registry) Register(eventName string, f HandlerFunc) {
+// Register registers f as the handler for eventName. middlewares are only applied to this event. Registering
+// a handler for an event again replaces both the handler and its middlewares.
+func (r *Registry) Register(eventName string, f HandlerFunc, middlewares ...Middleware) {
 	r.handlers[eventName] = f
+	r.eventMiddlewares[eventName] = middlewares
+	r.build(eventName)
+}
+
+// Use adds middlewares applied to the handlers of all events. Middlewares are applied in the order they are added,
+// the first one being the outermost.
+func (r *Registry) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+	for eventName := range r.handlers {
+		r.build(eventName)
+	}
 }
 
+// UseFor adds middlewares applied to the handler of eventName, inside the ones added with Use.
+func (r *Registry) UseFor(eventName string, middlewares ...Middleware) {
+	r.eventMiddlewares[eventName] = append(r.eventMiddlewares[eventName], middlewares...)
+	r.build(eventName)
+}
+
+// GetHandler returns the handler for eventName wrapped in its middlewares, or nil if no handler is registered.
 func (r *Registry) GetHandler(eventName string) HandlerFunc {
-	return r.handlers[eventName]
+	return r.chains[eventName]
+}
+
+// build wraps the handler of eventName in its middlewares.
+func (r *Registry) build(eventName string) {
+	handler, exists := r.handlers[eventName]
+	if !exists {
+		return
+	}
+
+	handler = Chain(r.eventMiddlewares[eventName]...)(handler)
+	r.chains[eventName] = Chain(r.middlewares...)(handler)
+}
+
+// Chain combines middlewares into one, the first one being the outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
 }
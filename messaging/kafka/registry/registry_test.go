@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, event model.HandlerContext) error {
+			*calls = append(*calls, name)
+			return next(ctx, event)
+		}
+	}
+}
+
+func TestRegistry_GetHandlerAppliesMiddlewaresInOrder(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Use(recordingMiddleware("global-1", &calls), recordingMiddleware("global-2", &calls))
+	r.Register("test-event", func(ctx context.Context, event model.HandlerContext) error {
+		calls = append(calls, "handler")
+		return nil
+	}, recordingMiddleware("event", &calls))
+	r.Register("other-event", func(ctx context.Context, event model.HandlerContext) error {
+		return nil
+	})
+
+	err := r.GetHandler("test-event")(context.Background(), model.HandlerContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"global-1", "global-2", "event", "handler"}, calls)
+
+	calls = nil
+	err = r.GetHandler("other-event")(context.Background(), model.HandlerContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"global-1", "global-2"}, calls)
+
+	assert.Nil(t, r.GetHandler("unknown-event"))
+}
+
+func TestRegistry_BuildsChainOnce(t *testing.T) {
+	built := 0
+	counting := func(next HandlerFunc) HandlerFunc {
+		built++
+		return next
+	}
+
+	r := NewRegistry()
+	r.Use(counting)
+	r.Register("test-event", func(ctx context.Context, event model.HandlerContext) error {
+		return nil
+	})
+	assert.Equal(t, 1, built)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.GetHandler("test-event")(context.Background(), model.HandlerContext{}))
+	}
+	assert.Equal(t, 1, built)
+}
+
+func TestRegistry_RegisterReplacesMiddlewares(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	handler := func(ctx context.Context, event model.HandlerContext) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+	r.Register("test-event", handler, recordingMiddleware("first", &calls))
+	r.Register("test-event", handler, recordingMiddleware("second", &calls))
+
+	assert.NoError(t, r.GetHandler("test-event")(context.Background(), model.HandlerContext{}))
+	assert.Equal(t, []string{"second", "handler"}, calls)
+
+	// Middlewares added after registering are applied as well
+	calls = nil
+	r.Use(recordingMiddleware("global", &calls))
+	r.UseFor("test-event", recordingMiddleware("event", &calls))
+	assert.NoError(t, r.GetHandler("test-event")(context.Background(), model.HandlerContext{}))
+	assert.Equal(t, []string{"global", "second", "event", "handler"}, calls)
+}
@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how many times, and how often, a failing handler is retried before the consumer gives up on a message.
+type RetryPolicy struct {
+	MaxAttempts    int           `envconfig:"MAX_ATTEMPTS" default:"3"`
+	InitialBackoff time.Duration `envconfig:"INITIAL_BACKOFF" default:"1s"`
+	MaxBackoff     time.Duration `envconfig:"MAX_BACKOFF" default:"30s"`
+	Multiplier     float64       `envconfig:"MULTIPLIER" default:"2"`
+	// Jitter is the fraction of the backoff that is randomised, e.g. 0.2 gives a backoff of +/- 20%.
+	Jitter float64 `envconfig:"JITTER" default:"0.2"`
+	// Retryable classifies whether an error is worth retrying. Defaults to IsRetryable.
+	Retryable func(err error) bool `ignored:"true"`
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *nonRetryableError) Unwrap() error {
+	return e.err
+}
+
+// NonRetryable marks err as not worth retrying, e.g. because the message itself is invalid.
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
+// IsRetryable reports whether err is worth retrying. Errors marked with NonRetryable and cancellations are not.
+func IsRetryable(err error) bool {
+	var nonRetryable *nonRetryableError
+	if errors.As(err, &nonRetryable) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// Backoff returns how long to wait before the given attempt, where attempt 1 is the first retry.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff = backoff + backoff*p.Jitter*(rand.Float64()*2-1)
+	}
+
+	return time.Duration(backoff)
+}
+
+// Run calls f until it succeeds, returns an error that isn't retryable, or MaxAttempts is reached.
+// attempts is the number of times f was called.
+func (p RetryPolicy) Run(ctx context.Context, f func(attempt int) error) (attempts int, err error) {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	for attempts = 1; ; attempts++ {
+		err = f(attempts)
+		if err == nil || attempts >= p.MaxAttempts || !retryable(err) {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(p.Backoff(attempts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Run(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	attempts, err := policy.Run(context.Background(), func(attempt int) error {
+		if attempt < 2 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts, err = policy.Run(context.Background(), func(attempt int) error {
+		return errors.New("permanent")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts, err = policy.Run(context.Background(), func(attempt int) error {
+		return NonRetryable(errors.New("invalid"))
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+}
@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap"
+)
+
+// Headers set on messages forwarded to a retry topic. The original partition and offset are those of the
+// message on the source topic.
+const (
+	RetryHeaderOriginalTopic     = "x-retry-original-topic"
+	RetryHeaderOriginalPartition = "x-retry-original-partition"
+	RetryHeaderOriginalOffset    = "x-retry-original-offset"
+	RetryHeaderAttempt           = "x-retry-attempt"
+	RetryHeaderDue               = "x-retry-due"
+	RetryHeaderError             = "x-retry-error"
+)
+
+type RetryTopicsConfig struct {
+	// Delays holds the delay of each retry topic. A message whose handler keeps failing is forwarded to
+	// <topic>.retry.1 with Delays[0], then to <topic>.retry.2 with Delays[1] and so on. Once the last retry
+	// topic fails, the message is published to the dead-letter topic, if enabled.
+	Delays []time.Duration
+}
+
+// RetryTopicName returns the name of the retry topic of the given level for topic.
+func RetryTopicName(topic string, level int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, level)
+}
+
+// EnableRetryTopics makes the consumer forward messages whose handler keeps failing to retry topics, instead of
+// blocking the partition. StartRetryConsumers must be called to consume the retry topics.
+func (c *Consumer) EnableRetryTopics(config RetryTopicsConfig) {
+	c.retryTopics = &config
+}
+
+// StartRetryConsumers starts a companion consumer for each retry topic. They wait until a message is due
+// before invoking the handler registered on this consumer.
+func (c *Consumer) StartRetryConsumers(initialHandlerContext *model.HandlerContext) {
+	if c.retryTopics == nil {
+		return
+	}
+
+	for level := range c.retryTopics.Delays {
+		retryConsumer := c.newRetryConsumer(level + 1)
+		go retryConsumer.StartConsumer(initialHandlerContext)
+	}
+}
+
+func (c *Consumer) newRetryConsumer(level int) *Consumer {
+	topic := RetryTopicName(c.sourceTopic, level)
+	groupId := fmt.Sprintf("%s.retry.%d", c.groupId, level)
+
+	retryConsumer := NewConsumerWithBroker(c.broker, topic, groupId, c.authConfig, c.dialer, c.logger.With(zap.Int("retryLevel", level)), c.wg, c.ctx)
+	retryConsumer.registry = c.registry
+	retryConsumer.retryPolicy = c.retryPolicy
+	retryConsumer.commitConfig = c.commitConfig
+	retryConsumer.concurrency = c.concurrency
+	retryConsumer.publisher.SetConfig(c.publisher.config)
+	retryConsumer.deadLetter = c.deadLetter
+	retryConsumer.deduplication = c.deduplication
+	retryConsumer.retryTopics = c.retryTopics
+	retryConsumer.retryLevel = level
+	retryConsumer.sourceTopic = c.sourceTopic
+
+	return retryConsumer
+}
+
+func (c *Consumer) nextRetryTopic() (string, time.Duration, bool) {
+	if c.retryTopics == nil || c.retryLevel >= len(c.retryTopics.Delays) {
+		return "", 0, false
+	}
+
+	level := c.retryLevel + 1
+	return RetryTopicName(c.sourceTopic, level), c.retryTopics.Delays[level-1], true
+}
+
+func (c *Consumer) publishRetry(msg kafka.Message, topic string, delay time.Duration, cause error) error {
+	partition, offset := c.originalPosition(msg)
+	headers := make([]kafka.Header, 0, len(msg.Headers)+6)
+	headers = append(headers, msg.Headers...)
+	headers = setHeader(headers, RetryHeaderOriginalTopic, c.sourceTopic)
+	headers = setHeader(headers, RetryHeaderOriginalPartition, partition)
+	headers = setHeader(headers, RetryHeaderOriginalOffset, offset)
+	headers = setHeader(headers, RetryHeaderAttempt, strconv.Itoa(c.retryLevel+1))
+	headers = setHeader(headers, RetryHeaderDue, time.Now().Add(delay).UTC().Format(time.RFC3339Nano))
+	headers = setHeader(headers, RetryHeaderError, cause.Error())
+
+	return c.publisher.Publish(topic, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+// originalPosition returns the partition and offset msg had on the source topic. Messages on retry topics carry
+// them in headers, as they get a new position each time they are forwarded.
+func (c *Consumer) originalPosition(msg kafka.Message) (string, string) {
+	if c.retryLevel > 0 {
+		partition, offset := headerValue(msg.Headers, RetryHeaderOriginalPartition), headerValue(msg.Headers, RetryHeaderOriginalOffset)
+		if partition != "" && offset != "" {
+			return partition, offset
+		}
+	}
+	return strconv.Itoa(msg.Partition), strconv.FormatInt(msg.Offset, 10)
+}
+
+// waitUntilDue blocks until a message on a retry topic is due. Returns false if the consumer is stopped meanwhile.
+func (c *Consumer) waitUntilDue(ctx context.Context, msg kafka.Message) bool {
+	due, err := time.Parse(time.RFC3339Nano, headerValue(msg.Headers, RetryHeaderDue))
+	if err != nil {
+		return true
+	}
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+
+	c.logger.Debug("Waiting for message to be due", zap.Int64("offset", msg.Offset), zap.Duration("wait", wait))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func headerValue(headers []kafka.Header, key string) string {
+	for _, header := range headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func setHeader(headers []kafka.Header, key string, value string) []kafka.Header {
+	for i, header := range headers {
+		if header.Key == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+	return append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func removeHeader(headers []kafka.Header, key string) []kafka.Header {
+	kept := headers[:0]
+	for _, header := range headers {
+		if header.Key != key {
+			kept = append(kept, header)
+		}
+	}
+	return kept
+}
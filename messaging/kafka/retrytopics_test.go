@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+func TestConsumer_NextRetryTopic(t *testing.T) {
+	c := &Consumer{sourceTopic: "cloudengineering.selfservice.capability"}
+
+	_, _, ok := c.nextRetryTopic()
+	assert.False(t, ok)
+
+	c.EnableRetryTopics(RetryTopicsConfig{Delays: []time.Duration{time.Minute, 10 * time.Minute}})
+	topic, delay, ok := c.nextRetryTopic()
+	assert.True(t, ok)
+	assert.Equal(t, "cloudengineering.selfservice.capability.retry.1", topic)
+	assert.Equal(t, time.Minute, delay)
+
+	c.retryLevel = 1
+	topic, delay, ok = c.nextRetryTopic()
+	assert.True(t, ok)
+	assert.Equal(t, "cloudengineering.selfservice.capability.retry.2", topic)
+	assert.Equal(t, 10*time.Minute, delay)
+
+	c.retryLevel = 2
+	_, _, ok = c.nextRetryTopic()
+	assert.False(t, ok)
+}
+
+func TestSetHeader(t *testing.T) {
+	headers := []kafka.Header{{Key: RetryHeaderAttempt, Value: []byte("1")}}
+	headers = setHeader(headers, RetryHeaderAttempt, "2")
+	headers = setHeader(headers, RetryHeaderError, "failed")
+
+	assert.Len(t, headers, 2)
+	assert.Equal(t, "2", headerValue(headers, RetryHeaderAttempt))
+	assert.Equal(t, "failed", headerValue(headers, RetryHeaderError))
+}
+
+func TestConsumer_RetryTopicForwarding(t *testing.T) {
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.EnableRetryTopics(RetryTopicsConfig{Delays: []time.Duration{time.Minute, 10 * time.Minute}})
+	consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic})
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		return errors.New("capability service unavailable")
+	})
+
+	msg := kafka.Message{
+		Topic:     testTopic,
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("sandbox-abcd"),
+		Value:     []byte(`{"eventName": "capability_created", "payload": {}}`),
+	}
+	assert.NoError(t, consumer.processMessage(msg, nil))
+
+	firstTopic := RetryTopicName(testTopic, 1)
+	forwarded := broker.Written(firstTopic)
+	if !assert.Len(t, forwarded, 1) {
+		return
+	}
+	first := forwarded[0]
+	assert.Equal(t, msg.Key, first.Key)
+	assert.Equal(t, msg.Value, first.Value)
+	assert.Equal(t, testTopic, headerValue(first.Headers, RetryHeaderOriginalTopic))
+	assert.Equal(t, "2", headerValue(first.Headers, RetryHeaderOriginalPartition))
+	assert.Equal(t, "42", headerValue(first.Headers, RetryHeaderOriginalOffset))
+	assert.Equal(t, "1", headerValue(first.Headers, RetryHeaderAttempt))
+	assert.Equal(t, "capability service unavailable", headerValue(first.Headers, RetryHeaderError))
+	due, err := time.Parse(time.RFC3339Nano, headerValue(first.Headers, RetryHeaderDue))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), due, 5*time.Second)
+
+	// On the retry topic the message has a position of its own, the original one is kept in the headers
+	first.Partition, first.Offset = 0, 7
+	retryConsumer := consumer.newRetryConsumer(1)
+	assert.NoError(t, retryConsumer.processMessage(first, nil))
+
+	secondTopic := RetryTopicName(testTopic, 2)
+	forwarded = broker.Written(secondTopic)
+	if !assert.Len(t, forwarded, 1) {
+		return
+	}
+	second := forwarded[0]
+	assert.Equal(t, "2", headerValue(second.Headers, RetryHeaderOriginalPartition))
+	assert.Equal(t, "42", headerValue(second.Headers, RetryHeaderOriginalOffset))
+	assert.Equal(t, "2", headerValue(second.Headers, RetryHeaderAttempt))
+
+	// Once the last retry topic fails, the dead-letter record points at the message on the source topic
+	second.Partition, second.Offset = 1, 3
+	assert.NoError(t, consumer.newRetryConsumer(2).processMessage(second, nil))
+	assert.Empty(t, broker.Written(RetryTopicName(testTopic, 3)))
+
+	published := broker.Written(testDeadLetterTopic)
+	if assert.Len(t, published, 1) {
+		deadLetter := published[0]
+		assert.Equal(t, testTopic, headerValue(deadLetter.Headers, DeadLetterHeaderOriginalTopic))
+		assert.Equal(t, "2", headerValue(deadLetter.Headers, DeadLetterHeaderOriginalPartition))
+		assert.Equal(t, "42", headerValue(deadLetter.Headers, DeadLetterHeaderOriginalOffset))
+	}
+}
+
+func TestConsumer_WaitUntilDue(t *testing.T) {
+	consumer := newTestConsumer(t, newTestBroker(), RetryTopicName(testTopic, 1))
+	due := func(at time.Time) kafka.Message {
+		return kafka.Message{Headers: []kafka.Header{{Key: RetryHeaderDue, Value: []byte(at.UTC().Format(time.RFC3339Nano))}}}
+	}
+
+	// Messages without a valid due time, or that are overdue, are processed right away
+	assert.True(t, consumer.waitUntilDue(context.Background(), kafka.Message{}))
+	assert.True(t, consumer.waitUntilDue(context.Background(), due(time.Now().Add(-time.Minute))))
+
+	start := time.Now()
+	assert.True(t, consumer.waitUntilDue(context.Background(), due(start.Add(50*time.Millisecond))))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, consumer.waitUntilDue(ctx, due(time.Now().Add(time.Hour))))
+}
@@ -0,0 +1,181 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// TLSConfig configures the TLS connections to the brokers, loaded from <PREFIX>_TLS_*. The CA bundle and the
+// client certificate are reloaded when their files change, so rotated certificates are picked up without a restart.
+type TLSConfig struct {
+	// CaFile is a PEM bundle of the CAs trusted to sign the certificates of the brokers. Defaults to the system pool.
+	CaFile string `envconfig:"CA_FILE"`
+	// CertFile and KeyFile hold the PEM encoded client certificate and key used for mutual TLS.
+	CertFile string `envconfig:"CERT_FILE"`
+	KeyFile  string `envconfig:"KEY_FILE"`
+	// ServerName overrides the name the certificates of the brokers are verified against.
+	ServerName string `envconfig:"SERVER_NAME"`
+	// MinVersion is the minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3.
+	MinVersion string `envconfig:"MIN_VERSION" default:"1.2"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func loadTLSConfig(envPrefix string) (*tls.Config, error) {
+	var config TLSConfig
+	err := envconfig.Process(fmt.Sprintf("%s_TLS", envPrefix), &config)
+	if err != nil {
+		return nil, err
+	}
+	return NewTLSConfig(config)
+}
+
+// NewTLSConfig creates the tls.Config described by config.
+func NewTLSConfig(config TLSConfig) (*tls.Config, error) {
+	minVersion, exists := tlsVersions[config.MinVersion]
+	if !exists {
+		return nil, fmt.Errorf("unsupported minimum TLS version %q, expected one of 1.0, 1.1, 1.2 or 1.3", config.MinVersion)
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("both a client certificate and key are required for mutual TLS")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: config.ServerName,
+	}
+
+	reloader := &certReloader{config: config}
+	if config.CertFile != "" {
+		if _, err := reloader.clientCertificate(); err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.clientCertificate()
+		}
+	}
+
+	if config.CaFile != "" {
+		if _, err := reloader.rootCAs(); err != nil {
+			return nil, err
+		}
+		// RootCAs can't be swapped on an existing tls.Config, so the verification normally done by crypto/tls
+		// is done by VerifyConnection instead, against the current CA bundle.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = reloader.verifyConnection
+	}
+
+	return tlsConfig, nil
+}
+
+// certReloader holds the CA pool and client certificate, reloading them when their files have been modified.
+type certReloader struct {
+	mu     sync.Mutex
+	config TLSConfig
+
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+
+	pool      *x509.CertPool
+	caModTime time.Time
+}
+
+func (r *certReloader) clientCertificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certModTime, certErr := modTime(r.config.CertFile)
+	keyModTime, keyErr := modTime(r.config.KeyFile)
+	if r.cert != nil && (certErr != nil || keyErr != nil || (certModTime.Equal(r.certModTime) && keyModTime.Equal(r.keyModTime))) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		// The files may be rotated one at a time, so the previous certificate is kept until both are in place
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	return r.cert, nil
+}
+
+func (r *certReloader) rootCAs() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	caModTime, err := modTime(r.config.CaFile)
+	if r.pool != nil && (err != nil || caModTime.Equal(r.caModTime)) {
+		return r.pool, nil
+	}
+
+	data, err := os.ReadFile(r.config.CaFile)
+	if err != nil {
+		if r.pool != nil {
+			return r.pool, nil
+		}
+		return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		if r.pool != nil {
+			return r.pool, nil
+		}
+		return nil, errors.New("unable to parse CA bundle, no PEM encoded certificates found")
+	}
+
+	r.pool = pool
+	r.caModTime = caModTime
+	return r.pool, nil
+}
+
+// verifyConnection verifies the certificate chain of the broker against the current CA bundle.
+func (r *certReloader) verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("broker presented no certificate")
+	}
+
+	pool, err := r.rootCAs()
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       state.ServerName,
+	})
+	return err
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// startTLSServer starts a server requiring client certificates signed by ca, reporting the common name of each client.
+func startTLSServer(t *testing.T, ca *testCert) (string, chan string) {
+	server := newTestCert(t, "broker", ca)
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	assert.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	clients := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil {
+				clients <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().String(), clients
+}
+
+func TestNewTLSConfigReloadsCertificates(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	addr, clients := startTLSServer(t, ca)
+
+	dir := t.TempDir()
+	config := TLSConfig{
+		CaFile:     filepath.Join(dir, "ca.pem"),
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client-key.pem"),
+		ServerName: "localhost",
+		MinVersion: "1.2",
+	}
+	modTime := time.Now().Add(-time.Minute)
+	client := newTestCert(t, "client-1", ca)
+	writeFile(t, config.CaFile, ca.certPEM, modTime)
+	writeFile(t, config.CertFile, client.certPEM, modTime)
+	writeFile(t, config.KeyFile, client.keyPEM, modTime)
+
+	tlsConfig, err := NewTLSConfig(config)
+	assert.NoError(t, err)
+
+	dial := func() error {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, tlsConfig)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return conn.Handshake()
+	}
+
+	assert.NoError(t, dial())
+	assert.Equal(t, "client-1", <-clients)
+
+	// A rotated client certificate is picked up
+	rotated := newTestCert(t, "client-2", ca)
+	writeFile(t, config.CertFile, rotated.certPEM, modTime.Add(time.Second))
+	writeFile(t, config.KeyFile, rotated.keyPEM, modTime.Add(time.Second))
+	assert.NoError(t, dial())
+	assert.Equal(t, "client-2", <-clients)
+
+	// So is a rotated CA bundle, no longer trusting the broker
+	writeFile(t, config.CaFile, newTestCert(t, "other-ca", nil).certPEM, modTime.Add(time.Second))
+	assert.Error(t, dial())
+}
+
+func TestNewTLSConfigValidation(t *testing.T) {
+	_, err := NewTLSConfig(TLSConfig{MinVersion: "1.4"})
+	assert.Error(t, err)
+
+	_, err = NewTLSConfig(TLSConfig{MinVersion: "1.2", CertFile: "client.pem"})
+	assert.Error(t, err)
+
+	_, err = NewTLSConfig(TLSConfig{MinVersion: "1.2", CaFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+
+	tlsConfig, err := NewTLSConfig(TLSConfig{MinVersion: "1.3", ServerName: "broker"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Equal(t, "broker", tlsConfig.ServerName)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+}
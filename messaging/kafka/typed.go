@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.dfds.cloud/messaging/kafka/registry"
+)
+
+// TypedHandlerFunc handles an event whose payload has already been decoded into T.
+type TypedHandlerFunc[T any] func(ctx context.Context, event model.EnvelopeWithPayload[T], meta model.HandlerContext) error
+
+// RegisterTyped registers a handler for eventName that receives the envelope with its payload decoded into T.
+// Messages whose payload can't be decoded are reported as poison messages.
+func RegisterTyped[T any](c *Consumer, eventName string, f TypedHandlerFunc[T], middlewares ...registry.Middleware) {
+	c.Register(eventName, TypedHandler(f), middlewares...)
+}
+
+// TypedHandler wraps f in a registry.HandlerFunc that decodes the payload of the message into T.
+func TypedHandler[T any](f TypedHandlerFunc[T]) registry.HandlerFunc {
+	return func(ctx context.Context, meta model.HandlerContext) error {
+		var event model.EnvelopeWithPayload[T]
+		err := json.Unmarshal(meta.Msg, &event)
+		if err != nil {
+			return PoisonMessage(fmt.Errorf("unable to decode payload of event: %w", err))
+		}
+
+		return f(ctx, event, meta)
+	}
+}
+
+type poisonMessageError struct {
+	err error
+}
+
+func (e *poisonMessageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *poisonMessageError) Unwrap() error {
+	return e.err
+}
+
+// PoisonMessage marks err as caused by a message that can never be handled, e.g. because its payload is invalid.
+// Poison messages aren't retried and go straight to the dead-letter topic, if enabled. Otherwise they are logged
+// and skipped, rather than stopping the consumer.
+func PoisonMessage(err error) error {
+	if err == nil {
+		return nil
+	}
+	return NonRetryable(&poisonMessageError{err: err})
+}
+
+func IsPoisonMessage(err error) bool {
+	var poison *poisonMessageError
+	return errors.As(err, &poison)
+}
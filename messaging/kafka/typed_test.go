@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+type capabilityCreated struct {
+	CapabilityId string `json:"capabilityId"`
+}
+
+func TestTypedHandler(t *testing.T) {
+	var received model.EnvelopeWithPayload[capabilityCreated]
+	handler := TypedHandler(func(ctx context.Context, event model.EnvelopeWithPayload[capabilityCreated], meta model.HandlerContext) error {
+		received = event
+		return nil
+	})
+
+	err := handler(context.Background(), model.HandlerContext{
+		Msg: []byte(`{"messageId": "1", "type": "capability_created", "payload": {"capabilityId": "sandbox-abcd"}}`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "capability_created", received.Type)
+	assert.Equal(t, "sandbox-abcd", received.Payload.CapabilityId)
+
+	err = handler(context.Background(), model.HandlerContext{
+		Msg: []byte(`{"type": "capability_created", "payload": {"capabilityId": 42}}`),
+	})
+	assert.Error(t, err)
+	assert.True(t, IsPoisonMessage(err))
+	assert.False(t, IsRetryable(err))
+}
+
+func TestPoisonMessage(t *testing.T) {
+	assert.Nil(t, PoisonMessage(nil))
+	assert.False(t, IsPoisonMessage(errors.New("dummy")))
+	assert.False(t, IsPoisonMessage(NonRetryable(errors.New("dummy"))))
+}
+
+func TestConsumer_SkipsPoisonMessageWithoutDeadLetter(t *testing.T) {
+	broker := newTestBroker()
+	consumer := newTestConsumer(t, broker, testTopic)
+	var handled []string
+	RegisterTyped(consumer, "capability_created", func(ctx context.Context, event model.EnvelopeWithPayload[capabilityCreated], meta model.HandlerContext) error {
+		handled = append(handled, event.Payload.CapabilityId)
+		return nil
+	})
+
+	reader := broker.reader(testTopic)
+	reader.messages <- kafka.Message{Topic: testTopic, Offset: 0, Value: []byte(`{"type": "capability_created", "payload": {"capabilityId": 42}}`)}
+	reader.messages <- kafka.Message{Topic: testTopic, Offset: 1, Value: []byte(`{"type": "capability_created", "payload": {"capabilityId": "sandbox-abcd"}}`)}
+	consumer.SetCommitConfig(CommitConfig{Count: 1, Interval: time.Hour})
+	go consumer.StartConsumer(nil)
+
+	// The poison message is committed along with the message after it, rather than stopping the consumer
+	assert.Eventually(t, func() bool {
+		return reader.Committed(0) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"sandbox-abcd"}, handled)
+}
+
+func TestConsumer_PoisonMessageFailsWhenDeadLetterFails(t *testing.T) {
+	broker := newTestBroker()
+	broker.writeErr = errors.New("broker unavailable")
+	consumer := newTestConsumer(t, broker, testTopic)
+	consumer.EnableDeadLetter(DeadLetterConfig{Topic: testDeadLetterTopic})
+	RegisterTyped(consumer, "capability_created", func(ctx context.Context, event model.EnvelopeWithPayload[capabilityCreated], meta model.HandlerContext) error {
+		return nil
+	})
+
+	err := consumer.processMessage(kafka.Message{Topic: testTopic, Value: []byte(`{"type": "capability_created", "payload": {"capabilityId": 42}}`)}, nil)
+	assert.True(t, IsPoisonMessage(err))
+}
@@ -14,12 +14,17 @@ type Config struct {
 	Wg              *sync.WaitGroup
 	Logger          *zap.Logger
 	kafkaAuthConfig kafka.AuthConfig
+	retryPolicy     kafka.RetryPolicy
+	commitConfig    kafka.CommitConfig
+	concurrency     kafka.ConcurrencyConfig
+	publisherConfig kafka.PublisherConfig
 }
 
 type Messaging struct {
 	Config  *Config
 	Context context.Context
 	dialer  *kafka2.Dialer
+	broker  kafka.Broker
 }
 
 func CreateMessaging() *Messaging {
@@ -37,21 +42,86 @@ func (m *Messaging) Init(ctx context.Context, cfg *Config) error {
 	}
 	m.Config.kafkaAuthConfig = authConfig
 
+	var retryPolicy kafka.RetryPolicy
+	err = envconfig.Process(m.Config.EnvVarPrefix+"_RETRY", &retryPolicy)
+	if err != nil {
+		return err
+	}
+	m.Config.retryPolicy = retryPolicy
+
+	var commitConfig kafka.CommitConfig
+	err = envconfig.Process(m.Config.EnvVarPrefix+"_COMMIT", &commitConfig)
+	if err != nil {
+		return err
+	}
+	m.Config.commitConfig = commitConfig
+
+	var concurrency kafka.ConcurrencyConfig
+	err = envconfig.Process(m.Config.EnvVarPrefix+"_CONCURRENCY", &concurrency)
+	if err != nil {
+		return err
+	}
+	m.Config.concurrency = concurrency
+
+	var publisherConfig kafka.PublisherConfig
+	err = envconfig.Process(m.Config.EnvVarPrefix+"_PUBLISHER", &publisherConfig)
+	if err != nil {
+		return err
+	}
+	m.Config.publisherConfig = publisherConfig
+
 	dialer, err := kafka.NewDialer(m.Config.EnvVarPrefix, authConfig)
 	if err != nil {
 		return err
 	}
 	m.dialer = dialer
+	m.broker = kafka.NewKafkaBroker()
 
 	return nil
 }
 
-func (m *Messaging) NewConsumer(topicName string, groupId string) *kafka.Consumer {
-	consumer := kafka.NewConsumer(topicName, groupId, m.Config.kafkaAuthConfig, m.dialer, m.Config.Logger, m.Config.Wg, m.Context)
+// InitWithBroker initialises m to consume from and publish to broker, instead of the cluster configured in the
+// environment. It is meant for tests, see the messagingtest package, so offsets are committed after every message
+// and failing handlers are retried without delay.
+func (m *Messaging) InitWithBroker(ctx context.Context, cfg *Config, broker kafka.Broker) error {
+	m.Config = cfg
+	m.Context = ctx
+
+	retryPolicy := kafka.DefaultRetryPolicy()
+	retryPolicy.InitialBackoff = 0
+	retryPolicy.MaxBackoff = 0
+	m.Config.retryPolicy = retryPolicy
+	m.Config.commitConfig = kafka.CommitConfig{Count: 1}
+	m.Config.publisherConfig = kafka.DefaultPublisherConfig()
+	m.broker = broker
+
+	return nil
+}
+
+// NewConsumer creates a Consumer of topicName. Use NewKafkaConsumer for the features specific to Kafka, e.g.
+// dead-letter and retry topics.
+func (m *Messaging) NewConsumer(topicName string, groupId string) Consumer {
+	return newKafkaConsumer(m.NewKafkaConsumer(topicName, groupId))
+}
+
+// NewKafkaConsumer creates a kafka.Consumer of topicName, configured from the environment.
+func (m *Messaging) NewKafkaConsumer(topicName string, groupId string) *kafka.Consumer {
+	consumer := kafka.NewConsumerWithBroker(m.broker, topicName, groupId, m.Config.kafkaAuthConfig, m.dialer, m.Config.Logger, m.Config.Wg, m.Context)
+	consumer.SetRetryPolicy(m.Config.retryPolicy)
+	consumer.SetCommitConfig(m.Config.commitConfig)
+	consumer.SetConcurrencyConfig(m.Config.concurrency)
+	consumer.SetPublisherConfig(m.Config.publisherConfig)
 	return consumer
 }
 
-func (m *Messaging) NewPublisher() *kafka.Publisher {
-	publisher := kafka.NewPublisher(m.Config.kafkaAuthConfig, m.dialer, m.Config.Logger, m.Context)
+// NewPublisher creates a Publisher. It must be closed on shutdown.
+func (m *Messaging) NewPublisher() Publisher {
+	return kafkaPublisher{publisher: m.NewKafkaPublisher()}
+}
+
+// NewKafkaPublisher creates a kafka.Publisher, configured from the environment. It must be closed on shutdown.
+func (m *Messaging) NewKafkaPublisher() *kafka.Publisher {
+	publisher := kafka.NewPublisherWithBroker(m.broker, m.Config.kafkaAuthConfig, m.dialer, m.Config.Logger, m.Context)
+	publisher.SetConfig(m.Config.publisherConfig)
 	return publisher
 }
@@ -0,0 +1,151 @@
+package messagingtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging"
+	kafka2 "go.dfds.cloud/messaging/kafka"
+	"go.dfds.cloud/messaging/kafka/memory"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap/zaptest"
+)
+
+// Harness runs Messaging against an in-memory broker for the duration of a test, so event flows can be tested
+// end-to-end without a Kafka cluster.
+type Harness struct {
+	Messaging *messaging.Messaging
+	Broker    *memory.Broker
+	// Timeout is how long PublishAndWait waits for messages to be processed.
+	Timeout time.Duration
+
+	t  testing.TB
+	wg *sync.WaitGroup
+}
+
+// New creates a Harness whose consumers are stopped when the test finishes.
+func New(t testing.TB) *Harness {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	broker := memory.NewBroker(1)
+
+	m := messaging.CreateMessaging()
+	err := m.InitWithBroker(ctx, &messaging.Config{Wg: wg, Logger: zaptest.NewLogger(t)}, broker)
+	if err != nil {
+		t.Fatalf("unable to initialise messaging: %v", err)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	return &Harness{
+		Messaging: m,
+		Broker:    broker,
+		Timeout:   5 * time.Second,
+		t:         t,
+		wg:        wg,
+	}
+}
+
+// StartConsumer starts consumer in the background, e.g. one created with Messaging.NewConsumer.
+func (h *Harness) StartConsumer(consumer messaging.Consumer) {
+	go consumer.Start()
+}
+
+// StartKafkaConsumer starts consumer in the background, along with its retry consumers.
+func (h *Harness) StartKafkaConsumer(consumer *kafka2.Consumer) {
+	consumer.StartRetryConsumers(nil)
+	go consumer.StartConsumer(nil)
+}
+
+// PublishAndWait writes msg to topic and waits until every consumer group reading from topic has processed it.
+// The test fails if that takes longer than Timeout.
+func (h *Harness) PublishAndWait(topic string, msg kafka.Message) kafka.Message {
+	h.t.Helper()
+
+	msg = h.Broker.Produce(topic, msg)
+
+	deadline := time.Now().Add(h.Timeout)
+	for _, groupId := range h.Broker.Groups(topic) {
+		for !h.Broker.Committed(groupId, msg) {
+			if time.Now().After(deadline) {
+				h.t.Fatalf("message %d on %s has not been processed by consumer group %s within %s", msg.Offset, topic, groupId, h.Timeout)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	return msg
+}
+
+// PublishEventAndWait wraps payload in the standard envelope, with a new correlation ID, and publishes it with
+// PublishAndWait.
+func (h *Harness) PublishEventAndWait(topic string, key string, eventName string, payload interface{}) kafka.Message {
+	h.t.Helper()
+
+	correlationId := uuid.NewString()
+	value, err := json.Marshal(model.EnvelopeWithPayload[interface{}]{
+		MessageId:      newMessageId(),
+		EventName:      eventName,
+		Version:        "1",
+		XCorrelationId: correlationId,
+		Payload:        payload,
+	})
+	if err != nil {
+		h.t.Fatalf("unable to marshal event: %v", err)
+	}
+
+	return h.PublishAndWait(topic, kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: []kafka.Header{{Key: kafka2.HeaderCorrelationId, Value: []byte(correlationId)}},
+	})
+}
+
+// Published returns the messages written to topic, in the order they were written.
+func (h *Harness) Published(topic string) []kafka.Message {
+	return h.Broker.Messages(topic)
+}
+
+// AssertPublished fails the test unless an event named eventName has been written to topic, returning the
+// matching messages.
+func (h *Harness) AssertPublished(topic string, eventName string) []kafka.Message {
+	h.t.Helper()
+
+	var matching []kafka.Message
+	for _, msg := range h.Broker.Messages(topic) {
+		event, err := kafka2.GetEventFromMsg(msg.Value)
+		if err != nil || event == nil {
+			continue
+		}
+		if event.Type == eventName || event.EventName == eventName {
+			matching = append(matching, msg)
+		}
+	}
+
+	if len(matching) == 0 {
+		h.t.Errorf("expected event %s to have been published to %s", eventName, topic)
+	}
+
+	return matching
+}
+
+func newMessageId() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err) // ideally this should never happen
+	}
+	return hex.EncodeToString(buf)
+}
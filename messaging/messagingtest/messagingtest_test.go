@@ -0,0 +1,82 @@
+package messagingtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging"
+	"go.dfds.cloud/messaging/kafka"
+	"go.dfds.cloud/messaging/kafka/model"
+)
+
+type capabilityCreated struct {
+	CapabilityId string `json:"capabilityId"`
+}
+
+type capabilityReady struct {
+	CapabilityId string `json:"capabilityId"`
+}
+
+func TestHarness_EventFlow(t *testing.T) {
+	h := New(t)
+	publisher := h.Messaging.NewKafkaPublisher()
+	t.Cleanup(func() { publisher.Close() })
+
+	consumer := h.Messaging.NewKafkaConsumer("cloudengineering.selfservice.capability", "capability-provisioner")
+	kafka.RegisterTyped(consumer, "capability_created", func(ctx context.Context, event model.EnvelopeWithPayload[capabilityCreated], meta model.HandlerContext) error {
+		_, err := kafka.PublishEvent(ctx, publisher, "cloudengineering.selfservice.provisioning", event.Payload.CapabilityId, "capability_ready", "1", capabilityReady{CapabilityId: event.Payload.CapabilityId})
+		return err
+	})
+	h.StartKafkaConsumer(consumer)
+
+	msg := h.PublishEventAndWait("cloudengineering.selfservice.capability", "sandbox-abcd", "capability_created", capabilityCreated{CapabilityId: "sandbox-abcd"})
+	incoming, err := kafka.GetEventFromMsg(msg.Value)
+	assert.NoError(t, err)
+
+	published := h.AssertPublished("cloudengineering.selfservice.provisioning", "capability_ready")
+	assert.Len(t, published, 1)
+	outgoing, err := kafka.GetEventFromMsg(published[0].Value)
+	assert.NoError(t, err)
+	assert.Equal(t, "sandbox-abcd", string(published[0].Key))
+	assert.Equal(t, incoming.XCorrelationId, outgoing.XCorrelationId)
+	assert.NotEqual(t, incoming.MessageId, outgoing.MessageId)
+}
+
+func TestHarness_StartConsumer(t *testing.T) {
+	h := New(t)
+
+	consumer := h.Messaging.NewConsumer("cloudengineering.selfservice.capability", "capability-provisioner")
+	consumer.Register("capability_created", func(ctx context.Context, event messaging.Event) error {
+		return messaging.PublishEvent(ctx, event.Publisher, "cloudengineering.selfservice.provisioning", string(event.Message.Key), "capability_ready", "1", capabilityReady{CapabilityId: string(event.Message.Key)})
+	})
+	h.StartConsumer(consumer)
+
+	msg := h.PublishEventAndWait("cloudengineering.selfservice.capability", "sandbox-abcd", "capability_created", capabilityCreated{CapabilityId: "sandbox-abcd"})
+	incoming, err := kafka.GetEventFromMsg(msg.Value)
+	assert.NoError(t, err)
+
+	published := h.AssertPublished("cloudengineering.selfservice.provisioning", "capability_ready")
+	if assert.Len(t, published, 1) {
+		outgoing, err := kafka.GetEventFromMsg(published[0].Value)
+		assert.NoError(t, err)
+		assert.Equal(t, incoming.XCorrelationId, outgoing.XCorrelationId)
+	}
+}
+
+func TestHarness_DeadLetter(t *testing.T) {
+	h := New(t)
+
+	consumer := h.Messaging.NewKafkaConsumer("cloudengineering.selfservice.capability", "capability-provisioner")
+	consumer.EnableDeadLetter(kafka.DeadLetterConfig{Topic: "cloudengineering.selfservice.capability.dlq"})
+	consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		return errors.New("provisioning failed")
+	})
+	h.StartKafkaConsumer(consumer)
+
+	h.PublishEventAndWait("cloudengineering.selfservice.capability", "sandbox-abcd", "capability_created", capabilityCreated{CapabilityId: "sandbox-abcd"})
+
+	deadLetters := h.AssertPublished("cloudengineering.selfservice.capability.dlq", "capability_created")
+	assert.Len(t, deadLetters, 1)
+}
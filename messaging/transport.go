@@ -0,0 +1,226 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	kafka2 "github.com/segmentio/kafka-go"
+	"go.dfds.cloud/messaging/kafka"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.dfds.cloud/messaging/kafka/registry"
+)
+
+// Transport creates consumers and publishers. It is implemented by Messaging. Services depending on Transport, rather
+// than on the concrete Kafka types, can swap in test doubles or other transports without rewriting their handlers.
+type Transport interface {
+	NewConsumer(topic string, groupId string) Consumer
+	NewPublisher() Publisher
+}
+
+var _ Transport = (*Messaging)(nil)
+
+// HandlerFunc handles an event consumed by a Consumer.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Middleware wraps a HandlerFunc, e.g. to log, trace or recover from panics.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Consumer hands the events of a topic to the handlers registered for them.
+type Consumer interface {
+	Topic() string
+	// Register registers f as the handler for eventName. middlewares are only applied to this event.
+	Register(eventName string, f HandlerFunc, middlewares ...Middleware)
+	// Use adds middlewares applied to the handlers of all events.
+	Use(middlewares ...Middleware)
+	// Start consumes events until the transport is stopped. It blocks, so it is usually called in a goroutine.
+	Start()
+}
+
+// Event is an event handed to a handler, independent of the transport it was consumed from.
+type Event struct {
+	Envelope model.Envelope
+	// Message is the message the event was read from.
+	Message   Message
+	Topic     string
+	Timestamp time.Time
+	// CorrelationId is taken from the envelope or the message headers, or generated if neither has one.
+	// It is also carried by the context passed to the handler.
+	CorrelationId string
+	// Publisher publishes through the transport the event was consumed from. Messages published with the context
+	// passed to the handler are correlated with the event. It is closed along with the consumer, not by handlers.
+	Publisher Publisher
+}
+
+// Message is a message to publish, or the message an event was read from, independent of the transport.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Publisher publishes messages to topics. Use PublishEvent to publish events in the standard envelope.
+type Publisher interface {
+	// Publish publishes msgs to topic, correlated with the message being handled if ctx carries its correlation ID.
+	Publish(ctx context.Context, topic string, msgs ...Message) error
+	// Close flushes pending messages and releases the resources of the publisher.
+	Close() error
+}
+
+// eventPublisher is implemented by Publishers that wrap events in the envelope themselves, e.g. to set x-sender.
+type eventPublisher interface {
+	publishEvent(ctx context.Context, topic string, key string, eventName string, version string, payload any) error
+}
+
+// PublishEvent publishes payload to topic through p, wrapped in the standard envelope.
+func PublishEvent[T any](ctx context.Context, p Publisher, topic string, key string, eventName string, version string, payload T) error {
+	if p, ok := p.(eventPublisher); ok {
+		return p.publishEvent(ctx, topic, key, eventName, version, payload)
+	}
+
+	messageId := uuid.NewString()
+	correlationId, ok := kafka.CorrelationIdFromContext(ctx)
+	if !ok {
+		correlationId = uuid.NewString()
+	}
+
+	value, err := json.Marshal(model.EnvelopeWithPayload[T]{
+		MessageId:      messageId,
+		EventName:      eventName,
+		Version:        version,
+		XCorrelationId: correlationId,
+		Payload:        payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.Publish(ctx, topic, Message{
+		Key:   []byte(key),
+		Value: value,
+		Headers: map[string]string{
+			kafka.HeaderMessageId:     messageId,
+			kafka.HeaderCorrelationId: correlationId,
+		},
+	})
+}
+
+type kafkaConsumer struct {
+	consumer *kafka.Consumer
+	// publisher is handed to handlers, publishing through the consumer
+	publisher Publisher
+}
+
+func newKafkaConsumer(consumer *kafka.Consumer) kafkaConsumer {
+	return kafkaConsumer{
+		consumer:  consumer,
+		publisher: consumerPublisher{kafkaPublisher{publisher: consumer.Publisher()}},
+	}
+}
+
+func (c kafkaConsumer) Topic() string {
+	return c.consumer.Topic()
+}
+
+func (c kafkaConsumer) Register(eventName string, f HandlerFunc, middlewares ...Middleware) {
+	c.consumer.Register(eventName, c.handler(f), c.middlewares(middlewares)...)
+}
+
+func (c kafkaConsumer) Use(middlewares ...Middleware) {
+	c.consumer.Use(c.middlewares(middlewares)...)
+}
+
+func (c kafkaConsumer) Start() {
+	initialHandlerContext := &model.HandlerContext{Writer: c.consumer.Publisher().Writer}
+	c.consumer.StartRetryConsumers(initialHandlerContext)
+	c.consumer.StartConsumer(initialHandlerContext)
+}
+
+func (c kafkaConsumer) handler(f HandlerFunc) registry.HandlerFunc {
+	return func(ctx context.Context, hc model.HandlerContext) error {
+		return f(ctx, c.event(hc))
+	}
+}
+
+func (c kafkaConsumer) middlewares(middlewares []Middleware) []registry.Middleware {
+	converted := make([]registry.Middleware, 0, len(middlewares))
+	for _, middleware := range middlewares {
+		converted = append(converted, func(next registry.HandlerFunc) registry.HandlerFunc {
+			return func(ctx context.Context, hc model.HandlerContext) error {
+				return middleware(func(ctx context.Context, event Event) error {
+					return next(ctx, hc)
+				})(ctx, c.event(hc))
+			}
+		})
+	}
+	return converted
+}
+
+func (c kafkaConsumer) event(hc model.HandlerContext) Event {
+	event := Event{
+		Message: Message{
+			Key:     hc.Key,
+			Value:   hc.Msg,
+			Headers: hc.HeaderMap(),
+		},
+		Topic:         hc.Topic,
+		Timestamp:     hc.Timestamp,
+		CorrelationId: hc.CorrelationId,
+		Publisher:     c.publisher,
+	}
+	if hc.Event != nil {
+		event.Envelope = *hc.Event
+	}
+	return event
+}
+
+type kafkaPublisher struct {
+	publisher *kafka.Publisher
+}
+
+func (p kafkaPublisher) Publish(ctx context.Context, topic string, msgs ...Message) error {
+	kafkaMsgs := make([]kafka2.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaMsgs = append(kafkaMsgs, kafka2.Message{
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: toHeaders(msg.Headers),
+		})
+	}
+
+	return p.publisher.PublishContext(ctx, topic, kafkaMsgs...)
+}
+
+func (p kafkaPublisher) publishEvent(ctx context.Context, topic string, key string, eventName string, version string, payload any) error {
+	_, err := kafka.PublishEvent(ctx, p.publisher, topic, key, eventName, version, payload)
+	return err
+}
+
+func (p kafkaPublisher) Close() error {
+	return p.publisher.Close()
+}
+
+// consumerPublisher is the publisher of a consumer as handed to its handlers, which leave closing it to the consumer.
+type consumerPublisher struct {
+	kafkaPublisher
+}
+
+func (consumerPublisher) Close() error {
+	return nil
+}
+
+func toHeaders(headers map[string]string) []kafka2.Header {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kafkaHeaders := make([]kafka2.Header, 0, len(headers))
+	for _, key := range keys {
+		kafkaHeaders = append(kafkaHeaders, kafka2.Header{Key: key, Value: []byte(headers[key])})
+	}
+	return kafkaHeaders
+}
@@ -0,0 +1,170 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/messaging/kafka"
+	"go.dfds.cloud/messaging/kafka/memory"
+	"go.dfds.cloud/messaging/kafka/model"
+	"go.uber.org/zap"
+)
+
+func newTestMessaging(t *testing.T) (*Messaging, *memory.Broker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	broker := memory.NewBroker(1)
+	m := CreateMessaging()
+	assert.NoError(t, m.InitWithBroker(ctx, &Config{Wg: wg, Logger: zap.NewNop()}, broker))
+	return m, broker
+}
+
+func receive[T any](t *testing.T, received <-chan T) T {
+	t.Helper()
+	select {
+	case value := <-received:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not handled")
+		var zero T
+		return zero
+	}
+}
+
+func TestTransport(t *testing.T) {
+	m, _ := newTestMessaging(t)
+	var transport Transport = m
+
+	received := make(chan Event, 2)
+	consumer := transport.NewConsumer("cloudengineering.selfservice.capability", "capability-provisioner")
+	consumer.Register("capability_created", func(ctx context.Context, event Event) error {
+		received <- event
+		return nil
+	})
+	go consumer.Start()
+
+	publisher := transport.NewPublisher()
+	defer publisher.Close()
+
+	err := PublishEvent(context.Background(), publisher, consumer.Topic(), "sandbox-abcd", "capability_created", "1", map[string]string{"capabilityId": "sandbox-abcd"})
+	assert.NoError(t, err)
+	err = publisher.Publish(context.Background(), consumer.Topic(), Message{
+		Key:     []byte("sandbox-efgh"),
+		Value:   []byte(`{"eventName": "capability_created", "payload": {"capabilityId": "sandbox-efgh"}}`),
+		Headers: map[string]string{"x-sender": "test"},
+	})
+	assert.NoError(t, err)
+
+	events := map[string]Event{}
+	for len(events) < 2 {
+		event := receive(t, received)
+		events[string(event.Message.Key)] = event
+	}
+
+	assert.Contains(t, events, "sandbox-abcd")
+	assert.Equal(t, "capability_created", events["sandbox-abcd"].Envelope.EventName)
+	assert.NotEmpty(t, events["sandbox-abcd"].CorrelationId)
+	assert.Equal(t, "cloudengineering.selfservice.capability", events["sandbox-efgh"].Topic)
+	assert.Equal(t, "test", events["sandbox-efgh"].Message.Headers["x-sender"])
+}
+
+type middlewareKey struct{}
+
+func TestTransport_HandlerPublishes(t *testing.T) {
+	m, broker := newTestMessaging(t)
+
+	consumer := m.NewConsumer("cloudengineering.selfservice.capability", "capability-provisioner")
+	consumer.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, event Event) error {
+			return next(context.WithValue(ctx, middlewareKey{}, true), event)
+		}
+	})
+	consumer.Register("capability_created", func(ctx context.Context, event Event) error {
+		// The middleware is applied
+		if ctx.Value(middlewareKey{}) == nil {
+			return nil
+		}
+		return PublishEvent(ctx, event.Publisher, "cloudengineering.selfservice.provisioning", string(event.Message.Key), "capability_ready", "1", struct {
+			CapabilityId string `json:"capabilityId"`
+		}{CapabilityId: string(event.Message.Key)})
+	})
+	go consumer.Start()
+
+	publisher := m.NewPublisher()
+	defer publisher.Close()
+	ctx := kafka.ContextWithCorrelationId(context.Background(), "correlation-1")
+	assert.NoError(t, PublishEvent(ctx, publisher, consumer.Topic(), "sandbox-abcd", "capability_created", "1", struct{}{}))
+
+	published := broker.Messages("cloudengineering.selfservice.provisioning")
+	for deadline := time.Now().Add(5 * time.Second); len(published) == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+		published = broker.Messages("cloudengineering.selfservice.provisioning")
+	}
+
+	if assert.Len(t, published, 1) {
+		var envelope model.EnvelopeWithPayload[map[string]string]
+		assert.NoError(t, json.Unmarshal(published[0].Value, &envelope))
+		assert.Equal(t, "capability_ready", envelope.EventName)
+		assert.Equal(t, "correlation-1", envelope.XCorrelationId)
+		assert.Equal(t, "sandbox-abcd", envelope.Payload["capabilityId"])
+	}
+}
+
+func TestKafkaConsumer_StartSetsWriter(t *testing.T) {
+	m, _ := newTestMessaging(t)
+
+	consumer := newKafkaConsumer(m.NewKafkaConsumer("cloudengineering.selfservice.capability", "capability-provisioner"))
+	hasWriter := make(chan bool, 1)
+	consumer.consumer.Register("capability_created", func(ctx context.Context, event model.HandlerContext) error {
+		hasWriter <- event.Writer != nil && event.Publish != nil
+		return nil
+	})
+	go consumer.Start()
+
+	publisher := m.NewPublisher()
+	defer publisher.Close()
+	assert.NoError(t, PublishEvent(context.Background(), publisher, consumer.Topic(), "sandbox-abcd", "capability_created", "1", struct{}{}))
+	assert.True(t, receive(t, hasWriter))
+}
+
+// recordingPublisher is a Publisher test double, recording the messages published with it.
+type recordingPublisher struct {
+	published []Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, topic string, msgs ...Message) error {
+	p.published = append(p.published, msgs...)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func TestPublishEvent(t *testing.T) {
+	publisher := &recordingPublisher{}
+	ctx := kafka.ContextWithCorrelationId(context.Background(), "correlation-1")
+	assert.NoError(t, PublishEvent(ctx, publisher, "cloudengineering.selfservice.capability", "sandbox-abcd", "capability_created", "1", map[string]string{"capabilityId": "sandbox-abcd"}))
+
+	if assert.Len(t, publisher.published, 1) {
+		msg := publisher.published[0]
+		var envelope model.EnvelopeWithPayload[map[string]string]
+		assert.NoError(t, json.Unmarshal(msg.Value, &envelope))
+		assert.Equal(t, "sandbox-abcd", string(msg.Key))
+		assert.Equal(t, "capability_created", envelope.EventName)
+		assert.Equal(t, "1", envelope.Version)
+		assert.Equal(t, "correlation-1", envelope.XCorrelationId)
+		assert.Equal(t, envelope.MessageId, msg.Headers[kafka.HeaderMessageId])
+		assert.Equal(t, "correlation-1", msg.Headers[kafka.HeaderCorrelationId])
+		assert.Equal(t, "sandbox-abcd", envelope.Payload["capabilityId"])
+	}
+}
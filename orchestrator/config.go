@@ -0,0 +1,228 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// JobsConfig describes the schedules of all jobs of a service. It is keyed by Job name.
+//
+// Example:
+//
+//	jobs:
+//	  capabilitySync:
+//	    enabled: true
+//	    interval: 5m
+//	    timeout: 1m
+//	    retries: 2
+//	    jitter: 30s
+//	    windows: ["06:00-22:00"]
+//	  nightlyReport:
+//	    enabled: true
+//	    cron: "0 2 * * *"
+type JobsConfig struct {
+	Jobs map[string]JobConfig `json:"jobs" yaml:"jobs"`
+}
+
+// JobConfig describes the schedule of a single Job. Fields that are left empty keep their current value.
+// A Job runs either at an Interval or on a Cron schedule, so setting both is rejected. Setting one replaces
+// the other, e.g. an Interval set through the environment overrides a Cron schedule set in a file.
+type JobConfig struct {
+	Enabled  *bool    `json:"enabled" yaml:"enabled"`
+	Interval string   `json:"interval" yaml:"interval"`
+	Cron     string   `json:"cron" yaml:"cron"`
+	Timeout  string   `json:"timeout" yaml:"timeout"`
+	Retries  *int     `json:"retries" yaml:"retries"`
+	Jitter   string   `json:"jitter" yaml:"jitter"`
+	Windows  []string `json:"windows" yaml:"windows"`
+}
+
+// LoadJobsConfigFile reads a JobsConfig from a YAML or JSON file. The format is picked based on the file extension.
+func LoadJobsConfigFile(path string) (*JobsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config JobsConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&config)
+	default:
+		return nil, fmt.Errorf("unsupported job configuration file format %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse job configuration file %s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// ApplyJobsConfig applies config to the schedules of the registered jobs, after which the environment
+// variables of each Job (e.g. PREFIX_JOBNAME_ENABLE) are applied on top as overrides.
+// All jobs in config must have been added with AddJob, and nothing is applied if any of the jobs are invalid.
+// ApplyJobsConfig should be called before Run.
+func (o *Orchestrator) ApplyJobsConfig(configPrefix string, config *JobsConfig) error {
+	schedules := map[string]Schedule{}
+	for name, jobConfig := range config.Jobs {
+		schedule, exists := o.scheduling[name]
+		if !exists {
+			return fmt.Errorf("job %s in configuration is not registered", name)
+		}
+
+		candidate := *schedule
+		err := candidate.applyJobConfig(jobConfig)
+		if err != nil {
+			return fmt.Errorf("invalid configuration for job %s: %w", name, err)
+		}
+
+		envConfig, err := candidate.envConfig(configPrefix)
+		if err == nil {
+			err = candidate.applyJobConfig(envConfig)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid environment configuration for job %s: %w", name, err)
+		}
+
+		schedules[name] = candidate
+	}
+
+	for name, candidate := range schedules {
+		schedule := o.scheduling[name]
+		*schedule = candidate
+		schedule.resetLastExecuted()
+		schedule.logConfig()
+	}
+
+	return nil
+}
+
+// LoadJobsConfigFile reads a JobsConfig from path and applies it with ApplyJobsConfig.
+func (o *Orchestrator) LoadJobsConfigFile(configPrefix string, path string) error {
+	config, err := LoadJobsConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return o.ApplyJobsConfig(configPrefix, config)
+}
+
+func (s *Schedule) applyJobConfig(config JobConfig) error {
+	if config.Enabled != nil {
+		s.enabled = *config.Enabled
+	}
+
+	if config.Interval != "" && config.Cron != "" {
+		return fmt.Errorf("interval and cron can't both be set")
+	}
+
+	if config.Interval != "" {
+		interval, err := time.ParseDuration(config.Interval)
+		if err != nil {
+			return err
+		}
+		s.interval = interval
+		s.cronSpec = ""
+		s.cron = nil
+	}
+
+	if config.Cron != "" {
+		schedule, err := cron.ParseStandard(config.Cron)
+		if err != nil {
+			return err
+		}
+		s.cronSpec = config.Cron
+		s.cron = schedule
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return err
+		}
+		s.timeout = timeout
+	}
+
+	if config.Retries != nil {
+		if *config.Retries < 0 {
+			return fmt.Errorf("retries can't be negative")
+		}
+		s.retries = *config.Retries
+	}
+
+	if config.Jitter != "" {
+		jitter, err := time.ParseDuration(config.Jitter)
+		if err != nil {
+			return err
+		}
+		s.jitter = jitter
+	}
+
+	if len(config.Windows) > 0 {
+		windows := make([]Window, 0, len(config.Windows))
+		for _, val := range config.Windows {
+			window, err := ParseWindow(val)
+			if err != nil {
+				return err
+			}
+			windows = append(windows, window)
+		}
+		s.windows = windows
+	}
+
+	return nil
+}
+
+// Window is a daily time range, in local time, during which a Job is allowed to start.
+// A Window whose end is before its start wraps around midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindow parses a Window in the format "15:04-15:04".
+func ParseWindow(val string) (Window, error) {
+	parts := strings.Split(strings.TrimSpace(val), "-")
+	if len(parts) != 2 {
+		return Window{}, fmt.Errorf("invalid window %s, expected format HH:MM-HH:MM", val)
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %s: %w", val, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %s: %w", val, err)
+	}
+
+	return Window{
+		Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+	}, nil
+}
+
+func (w Window) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(w.Start.Hours()), int(w.Start.Minutes())%60, int(w.End.Hours()), int(w.End.Minutes())%60)
+}
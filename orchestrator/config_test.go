@@ -0,0 +1,143 @@
+package orchestrator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testJobsConfig = `
+jobs:
+  capabilitySync:
+    enabled: true
+    interval: 5m
+    timeout: 1m
+    retries: 2
+    jitter: 30s
+    windows: ["06:00-22:00"]
+  nightlyReport:
+    enabled: true
+    cron: "0 2 * * *"
+`
+
+func writeJobsConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestOrchestrator_LoadJobsConfigFile(t *testing.T) {
+	t.Setenv("TESTCFG_CAPABILITYSYNC_INTERVAL", "10m")
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_load_jobs_config")
+	orc.AddJob("TESTCFG", NewJob("capabilitySync", func(ctx context.Context) error { return nil }), &Schedule{})
+	orc.AddJob("TESTCFG", NewJob("nightlyReport", func(ctx context.Context) error { return nil }), &Schedule{})
+
+	err := orc.LoadJobsConfigFile("TESTCFG", writeJobsConfig(t, "jobs.yaml", testJobsConfig))
+	assert.NoError(t, err)
+
+	capabilitySync := orc.Jobs["capabilitySync"].Schedule
+	assert.True(t, capabilitySync.Enabled())
+	assert.Equal(t, 10*time.Minute, capabilitySync.Interval())
+	assert.Equal(t, time.Minute, capabilitySync.Timeout())
+	assert.Equal(t, 2, capabilitySync.Retries())
+	assert.Equal(t, 30*time.Second, capabilitySync.Jitter())
+	assert.Equal(t, []Window{{Start: 6 * time.Hour, End: 22 * time.Hour}}, capabilitySync.Windows())
+
+	report := orc.Jobs["nightlyReport"].Schedule
+	assert.True(t, report.Enabled())
+	assert.Equal(t, "0 2 * * *", report.Cron())
+}
+
+func TestOrchestrator_ApplyJobsConfigUnknownJob(t *testing.T) {
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_apply_jobs_config_unknown")
+	orc.AddJob("TESTCFG", NewJob("capabilitySync", func(ctx context.Context) error { return nil }), &Schedule{})
+
+	err := orc.LoadJobsConfigFile("TESTCFG", writeJobsConfig(t, "jobs.yaml", testJobsConfig))
+	assert.Error(t, err)
+	assert.False(t, orc.Jobs["capabilitySync"].Schedule.Enabled())
+}
+
+func TestLoadJobsConfigFile_Json(t *testing.T) {
+	config, err := LoadJobsConfigFile(writeJobsConfig(t, "jobs.json", `{"jobs": {"capabilitySync": {"enabled": true, "interval": "5m"}}}`))
+	assert.NoError(t, err)
+	assert.True(t, *config.Jobs["capabilitySync"].Enabled)
+
+	_, err = LoadJobsConfigFile(writeJobsConfig(t, "jobs.json", `{"jobs": {"capabilitySync": {"enable": true}}}`))
+	assert.Error(t, err)
+}
+
+func TestWindow_Contains(t *testing.T) {
+	day, err := ParseWindow("06:00-22:00")
+	assert.NoError(t, err)
+	assert.True(t, day.Contains(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)))
+	assert.False(t, day.Contains(time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)))
+
+	night, err := ParseWindow("22:00-04:00")
+	assert.NoError(t, err)
+	assert.True(t, night.Contains(time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)))
+	assert.True(t, night.Contains(time.Date(2024, 1, 1, 3, 0, 0, 0, time.Local)))
+	assert.False(t, night.Contains(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)))
+
+	_, err = ParseWindow("06:00")
+	assert.Error(t, err)
+}
+
+func TestOrchestrator_AddJobWithCronFromEnvironment(t *testing.T) {
+	t.Setenv("TESTENVCRON_NIGHTLYREPORT_ENABLE", "true")
+	t.Setenv("TESTENVCRON_NIGHTLYREPORT_CRON", "0 2 * * *")
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_add_job_cron_env")
+	err := orc.AddJobE("TESTENVCRON", NewJob("nightlyReport", func(ctx context.Context) error { return nil }), &Schedule{})
+	assert.NoError(t, err)
+
+	schedule := orc.Jobs["nightlyReport"].Schedule
+	assert.Equal(t, "0 2 * * *", schedule.Cron())
+	assert.False(t, schedule.TimeToRun())
+}
+
+func TestOrchestrator_AddJobWithIntervalAndCron(t *testing.T) {
+	t.Setenv("TESTENVBOTH_NIGHTLYREPORT_INTERVAL", "1h")
+	t.Setenv("TESTENVBOTH_NIGHTLYREPORT_CRON", "0 2 * * *")
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_add_job_interval_and_cron")
+	err := orc.AddJobE("TESTENVBOTH", NewJob("nightlyReport", func(ctx context.Context) error { return nil }), &Schedule{})
+	assert.Error(t, err)
+	assert.NotContains(t, orc.Jobs, "nightlyReport")
+}
+
+func TestOrchestrator_AddJobWithInvalidEnvironment(t *testing.T) {
+	t.Setenv("TESTENVINVALID_CAPABILITYSYNC_INTERVAL", "often")
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_add_job_invalid_env")
+	err := orc.AddJobE("TESTENVINVALID", NewJob("capabilitySync", func(ctx context.Context) error { return nil }), &Schedule{})
+	assert.Error(t, err)
+
+	// AddJob logs the error instead
+	orc.AddJob("TESTENVINVALID", NewJob("capabilitySync", func(ctx context.Context) error { return nil }), &Schedule{})
+	assert.NotContains(t, orc.Jobs, "capabilitySync")
+
+	t.Setenv("TESTENVINVALID_CAPABILITYSYNC_ENABLE", "true")
+	schedule := &Schedule{name: "capabilitySync"}
+	schedule.LoadConfig("TESTENVINVALID")
+	assert.False(t, schedule.Enabled())
+}
+
+func TestOrchestrator_ApplyJobsConfigIntervalOverridesCron(t *testing.T) {
+	t.Setenv("TESTOVERRIDE_NIGHTLYREPORT_INTERVAL", "30m")
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_apply_jobs_config_override")
+	assert.NoError(t, orc.AddJobE("TESTOVERRIDE", NewJob("nightlyReport", func(ctx context.Context) error { return nil }), &Schedule{}))
+
+	err := orc.ApplyJobsConfig("TESTOVERRIDE", &JobsConfig{Jobs: map[string]JobConfig{"nightlyReport": {Cron: "0 2 * * *"}}})
+	assert.NoError(t, err)
+
+	schedule := orc.Jobs["nightlyReport"].Schedule
+	assert.Empty(t, schedule.Cron())
+	assert.Equal(t, 30*time.Minute, schedule.Interval())
+}
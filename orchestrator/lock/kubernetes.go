@@ -0,0 +1,324 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	inClusterTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAPath    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	microTimeFormat    = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var invalidLeaseNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// KubernetesLeaseLocker is a Locker backed by coordination.k8s.io/v1 Lease objects.
+// The service account needs permission to get, create, update and delete leases in the namespace.
+type KubernetesLeaseLocker struct {
+	client    *http.Client
+	host      string
+	namespace string
+	identity  string
+	prefix    string
+	token     func() (string, error)
+}
+
+// NewKubernetesLeaseLocker creates a KubernetesLeaseLocker for a client running inside the cluster.
+// identity identifies the replica holding a lease, usually the pod name.
+func NewKubernetesLeaseLocker(namespace string, identity string, prefix string) (*KubernetesLeaseLocker, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("unable to load in-cluster configuration, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be defined")
+	}
+
+	ca, err := os.ReadFile(inClusterCAPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("unable to parse in-cluster CA certificate")
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    pool,
+				MinVersion: tls.VersionTLS12,
+			},
+		},
+	}
+
+	return NewKubernetesLeaseLockerWithClient(client, "https://"+net.JoinHostPort(host, port), namespace, identity, prefix, func() (string, error) {
+		token, err := os.ReadFile(inClusterTokenPath)
+		return strings.TrimSpace(string(token)), err
+	}), nil
+}
+
+// NewKubernetesLeaseLockerWithClient creates a KubernetesLeaseLocker talking to the API server at host.
+// token is called for every request, so rotated tokens are picked up.
+func NewKubernetesLeaseLockerWithClient(client *http.Client, host string, namespace string, identity string, prefix string, token func() (string, error)) *KubernetesLeaseLocker {
+	return &KubernetesLeaseLocker{
+		client:    client,
+		host:      strings.TrimSuffix(host, "/"),
+		namespace: namespace,
+		identity:  identity,
+		prefix:    prefix,
+		token:     token,
+	}
+}
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+func (l *lease) expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renewTime, err := time.Parse(microTimeFormat, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewTime.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+func (l *KubernetesLeaseLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	k8sLock := &kubernetesLock{
+		locker: l,
+		name:   leaseName(l.prefix + key),
+		holder: fmt.Sprintf("%s_%s", l.identity, newToken()),
+	}
+	now := time.Now()
+
+	current, err := l.get(ctx, k8sLock.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		current = &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata: leaseMetadata{
+				Name:      k8sLock.name,
+				Namespace: l.namespace,
+			},
+		}
+		current.Spec = k8sLock.spec(now, now, ttl)
+		err = l.do(ctx, http.MethodPost, l.leasesPath(""), current, nil)
+	} else {
+		if !current.expired(now) {
+			return nil, ErrNotAcquired
+		}
+		current.Spec = k8sLock.spec(now, now, ttl)
+		err = l.do(ctx, http.MethodPut, l.leasesPath(k8sLock.name), current, nil)
+	}
+
+	if isConflict(err) {
+		return nil, ErrNotAcquired
+	}
+	if err != nil {
+		return nil, err
+	}
+	k8sLock.acquired = now
+
+	return k8sLock, nil
+}
+
+func (l *KubernetesLeaseLocker) leasesPath(name string) string {
+	path := fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.host, l.namespace)
+	if name != "" {
+		path = path + "/" + name
+	}
+	return path
+}
+
+func (l *KubernetesLeaseLocker) get(ctx context.Context, name string) (*lease, error) {
+	var current lease
+	err := l.do(ctx, http.MethodGet, l.leasesPath(name), nil, &current)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+func (l *KubernetesLeaseLocker) do(ctx context.Context, method string, url string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := l.token()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+
+	return nil
+}
+
+type kubernetesLock struct {
+	locker   *KubernetesLeaseLocker
+	name     string
+	holder   string
+	acquired time.Time
+}
+
+func (k *kubernetesLock) spec(acquired time.Time, renewed time.Time, ttl time.Duration) leaseSpec {
+	seconds := int32(ttl.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return leaseSpec{
+		HolderIdentity:       k.holder,
+		LeaseDurationSeconds: seconds,
+		AcquireTime:          acquired.UTC().Format(microTimeFormat),
+		RenewTime:            renewed.UTC().Format(microTimeFormat),
+	}
+}
+
+func (k *kubernetesLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	current, err := k.locker.get(ctx, k.name)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Spec.HolderIdentity != k.holder {
+		return ErrLockLost
+	}
+
+	current.Spec = k.spec(k.acquired, time.Now(), ttl)
+	err = k.locker.do(ctx, http.MethodPut, k.locker.leasesPath(k.name), current, nil)
+	if isConflict(err) {
+		return ErrLockLost
+	}
+	return err
+}
+
+func (k *kubernetesLock) Release(ctx context.Context) error {
+	current, err := k.locker.get(ctx, k.name)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Spec.HolderIdentity != k.holder {
+		return nil
+	}
+
+	deleteOptions := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "DeleteOptions",
+		"preconditions": map[string]string{
+			"resourceVersion": current.Metadata.ResourceVersion,
+		},
+	}
+	err = k.locker.do(ctx, http.MethodDelete, k.locker.leasesPath(k.name), deleteOptions, nil)
+	if isConflict(err) || isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+type apiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("kubernetes api returned status code %d: %s", e.StatusCode, e.Body)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// leaseName turns key into a valid Lease name. A hash of key is appended, so keys that only differ in case or
+// invalid characters get different names.
+func leaseName(key string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	suffix := fmt.Sprintf("%08x", hash.Sum32())
+
+	name := invalidLeaseNameChars.ReplaceAllString(strings.ToLower(key), "-")
+	name = strings.Trim(name, "-.")
+	if len(name) > 253-len(suffix)-1 {
+		name = strings.TrimRight(name[:253-len(suffix)-1], "-.")
+	}
+	if name == "" {
+		return suffix
+	}
+	return name + "-" + suffix
+}
@@ -0,0 +1,40 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotAcquired is returned by TryAcquire when the lock is held by someone else.
+var ErrNotAcquired = errors.New("lock is held by another owner")
+
+// ErrLockLost is returned by Refresh when the lock has expired or been taken over by someone else.
+var ErrLockLost = errors.New("lock has been lost")
+
+// Locker hands out distributed locks identified by a key.
+type Locker interface {
+	// TryAcquire attempts to acquire the lock for key without waiting for it. The lock expires after ttl
+	// unless it is refreshed.
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is an acquired lock.
+type Lock interface {
+	// Refresh extends the lock by ttl. ErrLockLost is only returned if the lock is known to be lost, other errors,
+	// e.g. of the connection, may be transient.
+	Refresh(ctx context.Context, ttl time.Duration) error
+	// Release gives up the lock.
+	Release(ctx context.Context) error
+}
+
+func newToken() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err) // ideally this should never happen
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,126 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	locker := NewMemoryLocker()
+	ctx := context.Background()
+
+	first, err := locker.TryAcquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+
+	_, err = locker.TryAcquire(ctx, "job", time.Minute)
+	assert.ErrorIs(t, err, ErrNotAcquired)
+	assert.NoError(t, first.Refresh(ctx, time.Minute))
+
+	assert.NoError(t, first.Release(ctx))
+	assert.False(t, locker.Held("job"))
+
+	second, err := locker.TryAcquire(ctx, "job", time.Millisecond)
+	assert.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.ErrorIs(t, second.Refresh(ctx, time.Minute), ErrLockLost)
+
+	_, err = locker.TryAcquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+}
+
+// fakeLeaseServer is a minimal stand-in for the coordination.k8s.io/v1 leases API.
+type fakeLeaseServer struct {
+	mu      sync.Mutex
+	leases  map[string]lease
+	version int
+}
+
+func (f *fakeLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/apis/coordination.k8s.io/v1/namespaces/test/leases")
+	name = strings.TrimPrefix(name, "/")
+
+	var body lease
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		name = body.Metadata.Name
+	}
+	current, exists := f.leases[name]
+
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(current)
+	case http.MethodPost:
+		if exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.store(w, body)
+	case http.MethodPut:
+		if !exists || current.Metadata.ResourceVersion != body.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.store(w, body)
+	case http.MethodDelete:
+		delete(f.leases, name)
+	}
+}
+
+func (f *fakeLeaseServer) store(w http.ResponseWriter, l lease) {
+	f.version++
+	l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	f.leases[l.Metadata.Name] = l
+	_ = json.NewEncoder(w).Encode(l)
+}
+
+func TestKubernetesLeaseLocker(t *testing.T) {
+	server := httptest.NewServer(&fakeLeaseServer{leases: map[string]lease{}})
+	defer server.Close()
+
+	token := func() (string, error) { return "token", nil }
+	first := NewKubernetesLeaseLockerWithClient(server.Client(), server.URL, "test", "pod-a", "svc-", token)
+	second := NewKubernetesLeaseLockerWithClient(server.Client(), server.URL, "test", "pod-b", "svc-", token)
+	ctx := context.Background()
+
+	lock, err := first.TryAcquire(ctx, "capabilitySync", time.Minute)
+	assert.NoError(t, err)
+
+	_, err = second.TryAcquire(ctx, "capabilitySync", time.Minute)
+	assert.ErrorIs(t, err, ErrNotAcquired)
+
+	assert.NoError(t, lock.Refresh(ctx, time.Minute))
+	assert.NoError(t, lock.Release(ctx))
+
+	lock, err = second.TryAcquire(ctx, "capabilitySync", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release(ctx))
+}
+
+func TestLeaseName(t *testing.T) {
+	assert.Regexp(t, `^svc-capabilitysync-[0-9a-f]{8}$`, leaseName("svc-capabilitySync"))
+	assert.Regexp(t, `^svc-my-job-[0-9a-f]{8}$`, leaseName("svc_my job"))
+	assert.Equal(t, leaseName("svc_my job"), leaseName("svc_my job"))
+
+	// Keys mapping to the same name don't collide
+	assert.NotEqual(t, leaseName("Job_A"), leaseName("job-a"))
+
+	long := leaseName(strings.Repeat("a", 300))
+	assert.Len(t, long, 253)
+	assert.Regexp(t, `^[0-9a-f]{8}$`, leaseName("__"))
+}
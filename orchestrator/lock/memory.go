@@ -0,0 +1,77 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker is an in-process Locker. It is intended for tests and services running a single replica.
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks: map[string]*memoryLock{},
+	}
+}
+
+func (l *MemoryLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if current, exists := l.locks[key]; exists && time.Now().Before(current.expires) {
+		return nil, ErrNotAcquired
+	}
+
+	lock := &memoryLock{
+		locker:  l,
+		key:     key,
+		token:   newToken(),
+		expires: time.Now().Add(ttl),
+	}
+	l.locks[key] = lock
+
+	return lock, nil
+}
+
+// Held reports whether the lock for key is currently held.
+func (l *MemoryLocker) Held(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current, exists := l.locks[key]
+	return exists && time.Now().Before(current.expires)
+}
+
+type memoryLock struct {
+	locker  *MemoryLocker
+	key     string
+	token   string
+	expires time.Time
+}
+
+func (m *memoryLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	current, exists := m.locker.locks[m.key]
+	if !exists || current.token != m.token || time.Now().After(current.expires) {
+		return ErrLockLost
+	}
+	current.expires = time.Now().Add(ttl)
+
+	return nil
+}
+
+func (m *memoryLock) Release(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+
+	if current, exists := m.locker.locks[m.key]; exists && current.token == m.token {
+		delete(m.locker.locks, m.key)
+	}
+
+	return nil
+}
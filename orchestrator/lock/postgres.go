@@ -0,0 +1,75 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// PostgresLocker is a Locker backed by PostgreSQL session level advisory locks. The caller is responsible
+// for registering a PostgreSQL driver for db.
+//
+// Advisory locks are held for as long as the database session is alive, so the ttl is not used. If the
+// replica holding the lock dies, PostgreSQL releases the lock once the session is closed.
+type PostgresLocker struct {
+	db     *sql.DB
+	prefix string
+}
+
+func NewPostgresLocker(db *sql.DB, prefix string) *PostgresLocker {
+	return &PostgresLocker{
+		db:     db,
+		prefix: prefix,
+	}
+}
+
+func (l *PostgresLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id := advisoryLockId(l.prefix + key)
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", id).Scan(&acquired)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, ErrNotAcquired
+	}
+
+	return &postgresLock{
+		conn: conn,
+		id:   id,
+	}, nil
+}
+
+type postgresLock struct {
+	conn *sql.Conn
+	id   int64
+}
+
+func (p *postgresLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	err := p.conn.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLockLost, err)
+	}
+	return nil
+}
+
+func (p *postgresLock) Release(ctx context.Context) error {
+	defer p.conn.Close()
+	_, err := p.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", p.id)
+	return err
+}
+
+func advisoryLockId(key string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return int64(hash.Sum64())
+}
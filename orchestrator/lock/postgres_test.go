@@ -0,0 +1,61 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresLocker(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	id := advisoryLockId("orchestrator:job")
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectPing()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	locker := NewPostgresLocker(db, "orchestrator:")
+	ctx := context.Background()
+
+	held, err := locker.TryAcquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, held.Refresh(ctx, time.Minute))
+	assert.NoError(t, held.Release(ctx))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLocker_NotAcquired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(advisoryLockId("job")).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	_, err = NewPostgresLocker(db, "").TryAcquire(context.Background(), "job", time.Minute)
+	assert.ErrorIs(t, err, ErrNotAcquired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLocker_LockLost(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectPing().WillReturnError(errors.New("connection reset by peer"))
+
+	held, err := NewPostgresLocker(db, "").TryAcquire(context.Background(), "job", time.Minute)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, held.Refresh(context.Background(), time.Minute), ErrLockLost)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
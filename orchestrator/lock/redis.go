@@ -0,0 +1,75 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var redisRefreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var redisReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker is a Locker backed by Redis keys set with SET NX and an expiry.
+type RedisLocker struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisLocker creates a RedisLocker. client is usually a *redis.Client or *redis.ClusterClient.
+func NewRedisLocker(client redis.Cmdable, prefix string) *RedisLocker {
+	return &RedisLocker{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (l *RedisLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	lock := &redisLock{
+		client: l.client,
+		key:    l.prefix + key,
+		token:  newToken(),
+	}
+
+	acquired, err := l.client.SetNX(ctx, lock.key, lock.token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrNotAcquired
+	}
+
+	return lock, nil
+}
+
+type redisLock struct {
+	client redis.Cmdable
+	key    string
+	token  string
+}
+
+func (r *redisLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	refreshed, err := redisRefreshScript.Run(ctx, r.client, []string{r.key}, r.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if refreshed == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *redisLock) Release(ctx context.Context) error {
+	return redisReleaseScript.Run(ctx, r.client, []string{r.key}, r.token).Err()
+}
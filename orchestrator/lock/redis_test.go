@@ -0,0 +1,65 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisLocker(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	locker := NewRedisLocker(client, "orchestrator:")
+	ctx := context.Background()
+
+	first, err := locker.TryAcquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, server.Exists("orchestrator:job"))
+	assert.Equal(t, time.Minute, server.TTL("orchestrator:job"))
+
+	_, err = locker.TryAcquire(ctx, "job", time.Minute)
+	assert.ErrorIs(t, err, ErrNotAcquired)
+
+	assert.NoError(t, first.Refresh(ctx, 2*time.Minute))
+	assert.Equal(t, 2*time.Minute, server.TTL("orchestrator:job"))
+
+	assert.NoError(t, first.Release(ctx))
+	assert.False(t, server.Exists("orchestrator:job"))
+
+	second, err := locker.TryAcquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+
+	// An expired lock can be taken over, after which the previous holder can neither refresh nor release it
+	server.FastForward(2 * time.Minute)
+	third, err := locker.TryAcquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, second.Refresh(ctx, time.Minute), ErrLockLost)
+	assert.NoError(t, second.Release(ctx))
+	assert.True(t, server.Exists("orchestrator:job"))
+
+	assert.NoError(t, third.Release(ctx))
+	assert.False(t, server.Exists("orchestrator:job"))
+}
+
+func TestRedisLocker_Unavailable(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+	server.Close()
+
+	_, err := NewRedisLocker(client, "orchestrator:").TryAcquire(context.Background(), "job", time.Minute)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotAcquired)
+
+	// Connection errors aren't reported as a lost lock
+	lock := &redisLock{client: client, key: "orchestrator:job", token: "token"}
+	err = lock.Refresh(context.Background(), time.Minute)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrLockLost)
+}
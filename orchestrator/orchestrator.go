@@ -2,27 +2,51 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"math/rand"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.dfds.cloud/orchestrator/lock"
 	configUtils "go.dfds.cloud/utils/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/robfig/cron/v3"
 )
 
 var logger = zap.NewNop()
 
+// retryDelay is how long a failed Job waits before it is retried
+var retryDelay = 10 * time.Second
+
+// DefaultLockTTL is the ttl of Job locks used when EnableJobLocking is given none.
+const DefaultLockTTL = 30 * time.Second
+
+// minLockTTL is the shortest ttl of Job locks, leaving time to refresh them while the Job is running.
+const minLockTTL = time.Second
+
 type Orchestrator struct {
-	status     map[string]*SyncStatus
-	scheduling map[string]*Schedule
-	Jobs       map[string]*Job
-	ctx        context.Context
-	wg         *sync.WaitGroup
-	metrics    *Metrics
+	status       map[string]*SyncStatus
+	scheduling   map[string]*Schedule
+	Jobs         map[string]*Job
+	ctx          context.Context
+	wg           *sync.WaitGroup
+	metrics      *Metrics
+	mu           sync.Mutex
+	tasks        map[string]*Task
+	taskHandlers map[string]func(ctx context.Context) error
+	taskStore    TaskStore
+	locker       lock.Locker
+	lockTTL      time.Duration
+	tracer       trace.Tracer
 }
 
 type Metrics struct {
@@ -30,6 +54,7 @@ type Metrics struct {
 	currentJobStatus   *prometheus.GaugeVec
 	jobFailedCount     *prometheus.GaugeVec
 	jobSuccessfulCount *prometheus.GaugeVec
+	jobPaused          *prometheus.GaugeVec
 }
 
 func setupMetrics(ns string) *Metrics {
@@ -54,6 +79,11 @@ func setupMetrics(ns string) *Metrics {
 			Help:      "How many times has {job_name} successfully completed.",
 			Namespace: ns,
 		}, []string{"name"}),
+		jobPaused: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name:      "job_is_paused",
+			Help:      "Is {job_name} paused. 1 = paused, 0 = not paused",
+			Namespace: ns,
+		}, []string{"name"}),
 	}
 }
 
@@ -78,7 +108,14 @@ type Schedule struct {
 	name         string
 	enabled      bool
 	interval     time.Duration
+	cronSpec     string
+	cron         cron.Schedule
+	timeout      time.Duration
+	retries      int
+	jitter       time.Duration
+	windows      []Window
 	lastExecuted time.Time
+	nextJitter   time.Duration
 }
 
 func (s *Schedule) Enabled() bool {
@@ -89,20 +126,125 @@ func (s *Schedule) Interval() time.Duration {
 	return s.interval
 }
 
+func (s *Schedule) Cron() string {
+	return s.cronSpec
+}
+
+func (s *Schedule) Timeout() time.Duration {
+	return s.timeout
+}
+
+func (s *Schedule) Retries() int {
+	return s.retries
+}
+
+func (s *Schedule) Jitter() time.Duration {
+	return s.jitter
+}
+
+func (s *Schedule) Windows() []Window {
+	return s.windows
+}
+
+// LoadConfig loads the schedule from the environment variables of the Job, e.g. PREFIX_JOBNAME_ENABLE. If the
+// configuration is invalid, the error is logged and the schedule is left disabled. Use LoadConfigE to handle it.
 func (s *Schedule) LoadConfig(configPrefix string) {
+	if err := s.LoadConfigE(configPrefix); err != nil {
+		logger.Error("Invalid environment configuration for job schedule, disabling it", zap.String("jobName", s.name), zap.Error(err))
+		s.enabled = false
+	}
+}
+
+// LoadConfigE is LoadConfig returning an error if the configuration is invalid.
+func (s *Schedule) LoadConfigE(configPrefix string) error {
+	s.enabled = false
+	s.interval = parseDuration("1h")
+
+	config, err := s.envConfig(configPrefix)
+	if err != nil {
+		return err
+	}
+	err = s.applyJobConfig(config)
+	if err != nil {
+		return err
+	}
+
+	s.logConfig()
+	return nil
+}
+
+func (s *Schedule) logConfig() {
+	logger.Info(fmt.Sprintf("Job schedule %s loaded with the following configuration: Enabled: %t, Interval(in seconds): %d, Cron: %s, Timeout: %s, Retries: %d, Jitter: %s, Windows: %v", s.name, s.Enabled(), int64(s.Interval().Seconds()), s.Cron(), s.Timeout(), s.Retries(), s.Jitter(), s.Windows()))
+}
+
+func (s *Schedule) envConfig(configPrefix string) (JobConfig, error) {
 	prefix := fmt.Sprintf("%s_%s", configPrefix, strings.ToUpper(s.name))
-	configPath := fmt.Sprintf("%s_ENABLE", prefix)
-	s.enabled = configUtils.GetEnvBool(configPath, false)
+	enabled := configUtils.GetEnvBool(fmt.Sprintf("%s_ENABLE", prefix), s.enabled)
+	retries, err := configUtils.GetEnvInt(fmt.Sprintf("%s_RETRIES", prefix), s.retries)
+	if err != nil {
+		return JobConfig{}, err
+	}
+
+	var windows []string
+	if val := configUtils.GetEnvValue(fmt.Sprintf("%s_WINDOWS", prefix), ""); val != "" {
+		windows = strings.Split(val, ",")
+	}
+
+	return JobConfig{
+		Enabled:  &enabled,
+		Interval: configUtils.GetEnvValue(fmt.Sprintf("%s_INTERVAL", prefix), ""),
+		Cron:     configUtils.GetEnvValue(fmt.Sprintf("%s_CRON", prefix), ""),
+		Timeout:  configUtils.GetEnvValue(fmt.Sprintf("%s_TIMEOUT", prefix), ""),
+		Retries:  &retries,
+		Jitter:   configUtils.GetEnvValue(fmt.Sprintf("%s_JITTER", prefix), ""),
+		Windows:  windows,
+	}, nil
+}
+
+func (s *Schedule) nextExecution() time.Time {
+	if s.cron != nil {
+		return s.cron.Next(s.lastExecuted).Add(s.nextJitter)
+	}
+	return s.lastExecuted.Add(s.interval).Add(s.nextJitter)
+}
 
-	configPath = fmt.Sprintf("%s_INTERVAL", prefix)
-	s.interval = parseDuration(configUtils.GetEnvValue(configPath, "1h"))
+// resetLastExecuted makes interval based schedules due right away, while cron based schedules wait for their
+// next tick.
+func (s *Schedule) resetLastExecuted() {
+	if s.cron != nil {
+		s.lastExecuted = time.Now()
+	} else {
+		s.lastExecuted = time.Now().Add(-s.interval)
+	}
+}
+
+func (s *Schedule) markExecuted(t time.Time) {
+	s.lastExecuted = t
+	s.nextJitter = 0
+	if s.jitter > 0 {
+		s.nextJitter = time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+}
 
-	logger.Info(fmt.Sprintf("Job schedule %s loaded with the following configuration: Enabled: %t, Interval(in seconds): %d", s.name, s.Enabled(), int64(s.Interval().Seconds())))
+func (s *Schedule) inWindow(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+	for _, window := range s.windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Schedule) TimeToRun() bool {
+	if !s.inWindow(time.Now()) {
+		return false
+	}
+
 	now := time.Now().Unix()
-	nextExecution := s.lastExecuted.Add(s.interval).Unix()
+	nextExecution := s.nextExecution().Unix()
 	diff := nextExecution - now
 	if diff < 0 {
 		return true
@@ -113,12 +255,15 @@ func (s *Schedule) TimeToRun() bool {
 
 func NewOrchestrator(ctx context.Context, wg *sync.WaitGroup, metricsNamespace string) *Orchestrator {
 	return &Orchestrator{
-		Jobs:       map[string]*Job{},
-		scheduling: map[string]*Schedule{},
-		status:     map[string]*SyncStatus{},
-		ctx:        ctx,
-		wg:         wg,
-		metrics:    setupMetrics(metricsNamespace),
+		Jobs:         map[string]*Job{},
+		scheduling:   map[string]*Schedule{},
+		status:       map[string]*SyncStatus{},
+		ctx:          ctx,
+		wg:           wg,
+		metrics:      setupMetrics(metricsNamespace),
+		tasks:        map[string]*Task{},
+		taskHandlers: map[string]func(ctx context.Context) error{},
+		tracer:       otel.Tracer(tracerName),
 	}
 }
 
@@ -126,18 +271,41 @@ func (o *Orchestrator) Run() {
 	go func() {
 		logger.Info("Initialising Orchestrator")
 		for {
+			select {
+			case <-o.ctx.Done():
+				logger.Info("Orchestrator stopped, no further jobs will be started")
+				return
+			default:
+			}
+
 			//util.Logger.Debug("Checking if jobs need to be started")
 			for _, job := range o.Jobs {
-				if job.Schedule.Enabled() && job.Schedule.TimeToRun() {
-					job.Run()
+				if job.Schedule.Enabled() && !job.Paused() && job.due() {
+					job.run(TriggerSchedule)
 				}
 			}
+			o.runDueTasks()
 			time.Sleep(1 * time.Second)
 		}
 	}()
 }
 
+// AddJob adds job with its schedule loaded from the environment variables of the Job. If the schedule is invalid,
+// the error is logged and job isn't added. Use AddJobE to handle it.
 func (o *Orchestrator) AddJob(configPrefix string, job *Job, schedule *Schedule) {
+	if err := o.AddJobE(configPrefix, job, schedule); err != nil {
+		logger.Error("Unable to add job", zap.String("jobName", job.Name), zap.Error(err))
+	}
+}
+
+// AddJobE is AddJob returning an error if the schedule is invalid, in which case job isn't added.
+func (o *Orchestrator) AddJobE(configPrefix string, job *Job, schedule *Schedule) error {
+	schedule.name = job.Name
+	if err := schedule.LoadConfigE(configPrefix); err != nil {
+		return fmt.Errorf("invalid environment configuration for job %s: %w", job.Name, err)
+	}
+	schedule.resetLastExecuted()
+
 	o.status[job.Name] = &SyncStatus{active: false}
 	o.scheduling[job.Name] = schedule
 	job.context = o.ctx
@@ -145,12 +313,33 @@ func (o *Orchestrator) AddJob(configPrefix string, job *Job, schedule *Schedule)
 	job.Status = o.status[job.Name]
 	job.Schedule = schedule
 	job.metrics = o.metrics
-
-	schedule.name = job.Name
-	schedule.LoadConfig(configPrefix)
-	schedule.lastExecuted = time.Now().Add(-schedule.interval)
+	job.locker = o.locker
+	job.lockTTL = o.lockTTL
+	job.tracer = o.tracer
 
 	o.Jobs[job.Name] = job
+	return nil
+}
+
+// EnableJobLocking makes jobs acquire a distributed lock named after the Job before running, so a Job is never
+// run by more than one replica at a time. The lock is refreshed while the Job is running and expires after ttl
+// if the replica holding it dies. ttl defaults to DefaultLockTTL and must be at least a second. One-off tasks
+// are not locked.
+func (o *Orchestrator) EnableJobLocking(locker lock.Locker, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = DefaultLockTTL
+	}
+	if ttl < minLockTTL {
+		return fmt.Errorf("job lock ttl %s is shorter than the minimum of %s", ttl, minLockTTL)
+	}
+
+	o.locker = locker
+	o.lockTTL = ttl
+	for _, job := range o.Jobs {
+		job.locker = locker
+		job.lockTTL = ttl
+	}
+	return nil
 }
 
 func (o *Orchestrator) JobStatus(name string) *SyncStatus {
@@ -166,19 +355,26 @@ func (o *Orchestrator) JobStatusProgress(name string) bool {
 }
 
 func (o *Orchestrator) Init(val *zap.Logger) {
-	if logger != nil {
+	if val != nil {
 		logger = val
 	}
 }
 
 type Job struct {
 	Name     string
+	Tags     []string
 	Status   *SyncStatus
 	context  context.Context
 	handler  func(ctx context.Context) error
 	wg       *sync.WaitGroup
 	Schedule *Schedule
 	metrics  *Metrics
+	locker   lock.Locker
+	lockTTL  time.Duration
+	tracer   trace.Tracer
+	paused   atomic.Bool
+	// retryAt is when, in Unix nanoseconds, a Job that couldn't run because of its lock is started again
+	retryAt atomic.Int64
 }
 
 func NewJob(name string, handler func(ctx context.Context) error) *Job {
@@ -188,21 +384,71 @@ func NewJob(name string, handler func(ctx context.Context) error) *Job {
 	}
 }
 
+// Run starts the Job right away, regardless of its schedule.
 func (j *Job) Run() {
+	j.run(TriggerManual)
+}
+
+// due reports whether the scheduler should start the Job, either because it is scheduled to run or because
+// a previous run has to be retried.
+func (j *Job) due() bool {
+	retryAt := j.retryAt.Load()
+	if retryAt != 0 && time.Now().UnixNano() >= retryAt && j.Schedule.inWindow(time.Now()) {
+		return true
+	}
+	return j.Schedule.TimeToRun()
+}
+
+// retryLater makes the scheduler start the Job again after retryDelay, rather than at its next scheduled run.
+// It is used when the Job has been marked as executed, but couldn't run because of its lock.
+func (j *Job) retryLater() {
+	j.retryAt.Store(time.Now().Add(retryDelay).UnixNano())
+}
+
+func (j *Job) run(trigger Trigger) {
 	if j.Status.InProgress() {
 		logger.Warn("Can't start Job because Job is already in progress.", zap.String("jobName", j.Name))
 		return
 	}
-	j.Schedule.lastExecuted = time.Now()
+	if j.Schedule != nil {
+		j.Schedule.markExecuted(time.Now())
+	}
+	j.retryAt.Store(0)
 	j.Status.SetStatus(true)
 	j.wg.Add(1)
-	j.metrics.currentJobsGauge.Inc()
-	j.metrics.currentJobStatus.WithLabelValues(j.Name).Set(1)
-	logger.Warn("Job started", zap.String("jobName", j.Name))
 
 	go func() {
 		defer j.wg.Done()
-		err := j.handler(j.context)
+		defer j.Status.SetStatus(false)
+
+		ctx, span := j.startSpan(trigger)
+		defer span.End()
+
+		ctx, release, err := j.acquireLock(ctx)
+		if errors.Is(err, lock.ErrNotAcquired) {
+			span.SetAttributes(attribute.String("job.outcome", "skipped"))
+			logger.Info("Job skipped because it is already running elsewhere", zap.String("jobName", j.Name))
+			return
+		} else if err != nil {
+			j.metrics.jobFailedCount.WithLabelValues(j.Name).Inc()
+			endSpan(span, err)
+			logger.Error("Unable to acquire lock for Job, retrying it later", zap.String("jobName", j.Name), zap.Error(err))
+			j.retryLater()
+			return
+		}
+		defer release()
+
+		j.metrics.currentJobsGauge.Inc()
+		j.metrics.currentJobStatus.WithLabelValues(j.Name).Set(1)
+		logger.Warn("Job started", zap.String("jobName", j.Name), zap.String("trigger", string(trigger)))
+
+		err = j.execute(ctx)
+		if errors.Is(context.Cause(ctx), lock.ErrLockLost) {
+			// Other replicas consider the Job executed as well, so it has to be run again rather than skipped
+			logger.Warn("Job cancelled after losing its lock, retrying it later", zap.String("jobName", j.Name))
+			j.retryLater()
+		}
+		endSpan(span, err)
 		if err != nil {
 			j.metrics.jobFailedCount.WithLabelValues(j.Name).Inc()
 			logger.Error("Job failed", zap.String("jobName", j.Name), zap.Error(err))
@@ -211,10 +457,102 @@ func (j *Job) Run() {
 		}
 		j.metrics.currentJobsGauge.Dec()
 		j.metrics.currentJobStatus.WithLabelValues(j.Name).Set(0)
-		j.Status.SetStatus(false)
 		logger.Warn("Job ended", zap.String("jobName", j.Name))
+	}()
+}
+
+// acquireLock acquires the distributed lock of the Job, if locking is enabled, and keeps refreshing it until
+// the returned release func is called. The returned context is cancelled with lock.ErrLockLost as its cause if
+// the lock is lost.
+func (j *Job) acquireLock(parent context.Context) (context.Context, func(), error) {
+	if j.locker == nil {
+		return parent, func() {}, nil
+	}
+
+	jobLock, err := j.locker.TryAcquire(parent, j.Name, j.lockTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(j.lockTTL / 3)
+		defer ticker.Stop()
+		refreshed := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := jobLock.Refresh(ctx, j.lockTTL)
+				if err == nil || ctx.Err() != nil {
+					refreshed = time.Now()
+					continue
+				}
 
+				// Other errors are likely transient, the lock is only given up once it has expired
+				if errors.Is(err, lock.ErrLockLost) || time.Since(refreshed) >= j.lockTTL {
+					logger.Error("Lost lock for Job, cancelling it", zap.String("jobName", j.Name), zap.Error(err))
+					cancel(lock.ErrLockLost)
+					return
+				}
+				logger.Warn("Unable to refresh lock for Job, retrying", zap.String("jobName", j.Name), zap.Error(err))
+			}
+		}
 	}()
+
+	release := func() {
+		close(done)
+		cancel(nil)
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer releaseCancel()
+		if err := jobLock.Release(releaseCtx); err != nil {
+			logger.Error("Unable to release lock for Job", zap.String("jobName", j.Name), zap.Error(err))
+		}
+	}
+
+	return ctx, release, nil
+}
+
+func (j *Job) execute(ctx context.Context) error {
+	var timeout time.Duration
+	var retries int
+	if j.Schedule != nil {
+		timeout = j.Schedule.timeout
+		retries = j.Schedule.retries
+	}
+
+	span := trace.SpanFromContext(ctx)
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		span.SetAttributes(attribute.Int("job.attempt", attempt+1))
+		if attempt > 0 {
+			span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+			logger.Warn("Retrying failed Job", zap.String("jobName", j.Name), zap.Int("attempt", attempt), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(retryDelay):
+			}
+		}
+
+		err = j.runHandler(ctx, timeout)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (j *Job) runHandler(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return j.handler(ctx)
 }
 
 func parseDuration(val string) time.Duration {
@@ -5,8 +5,15 @@ import (
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.dfds.cloud/orchestrator/lock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestJob_Run(t *testing.T) {
@@ -19,7 +26,8 @@ func TestJob_Run(t *testing.T) {
 		handler: func(ctx context.Context) error {
 			return nil
 		},
-		wg: &sync.WaitGroup{},
+		wg:      &sync.WaitGroup{},
+		metrics: setupMetrics("test_job_run"),
 	}
 
 	j.Run()
@@ -34,13 +42,195 @@ func TestJob_Run(t *testing.T) {
 	j.wg.Wait()
 }
 
+func TestJob_RunWithLock(t *testing.T) {
+	locker := lock.NewMemoryLocker()
+	runs := 0
+	j := &Job{
+		Name:     "locked",
+		Status:   &SyncStatus{active: false},
+		Schedule: &Schedule{},
+		context:  context.Background(),
+		handler: func(ctx context.Context) error {
+			runs++
+			return nil
+		},
+		wg:      &sync.WaitGroup{},
+		metrics: setupMetrics("test_job_run_with_lock"),
+		locker:  locker,
+		lockTTL: time.Minute,
+	}
+
+	held, err := locker.TryAcquire(context.Background(), "locked", time.Minute)
+	assert.NoError(t, err)
+	j.Run()
+	j.wg.Wait()
+	assert.Equal(t, 0, runs)
+
+	assert.NoError(t, held.Release(context.Background()))
+	j.Run()
+	j.wg.Wait()
+	assert.Equal(t, 1, runs)
+	assert.False(t, locker.Held("locked"))
+}
+
+// failingLocker is a Locker whose locks can't be acquired, or are lost right after being acquired.
+type failingLocker struct {
+	acquireErr error
+	// refreshErr is returned by Refresh instead of lock.ErrLockLost if set
+	refreshErr error
+}
+
+func (f *failingLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (lock.Lock, error) {
+	if f.acquireErr != nil {
+		return nil, f.acquireErr
+	}
+	return f, nil
+}
+
+func (f *failingLocker) Refresh(ctx context.Context, ttl time.Duration) error {
+	if f.refreshErr != nil {
+		return f.refreshErr
+	}
+	return lock.ErrLockLost
+}
+
+func (f *failingLocker) Release(ctx context.Context) error {
+	return nil
+}
+
+func newScheduledJob(name string, locker lock.Locker, lockTTL time.Duration, handler func(ctx context.Context) error) *Job {
+	return &Job{
+		Name:     name,
+		Status:   &SyncStatus{active: false},
+		Schedule: &Schedule{enabled: true, interval: time.Hour},
+		context:  context.Background(),
+		handler:  handler,
+		wg:       &sync.WaitGroup{},
+		metrics:  setupMetrics("test_" + name),
+		locker:   locker,
+		lockTTL:  lockTTL,
+	}
+}
+
+func TestJob_RunRetriesWhenLockUnavailable(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 0
+
+	runs := 0
+	j := newScheduledJob("lock_unavailable", &failingLocker{acquireErr: errors.New("connection refused")}, time.Minute, func(ctx context.Context) error {
+		runs++
+		return nil
+	})
+
+	j.run(TriggerSchedule)
+	j.wg.Wait()
+	assert.Equal(t, 0, runs)
+	assert.False(t, j.Schedule.TimeToRun())
+	assert.True(t, j.due())
+
+	// A Job that is skipped because another replica holds the lock isn't retried
+	j.locker = &failingLocker{acquireErr: lock.ErrNotAcquired}
+	j.run(TriggerSchedule)
+	j.wg.Wait()
+	assert.False(t, j.due())
+}
+
+func TestJob_RunRetriesWhenLockLost(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 0
+
+	j := newScheduledJob("lock_lost", &failingLocker{}, 30*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	j.run(TriggerSchedule)
+	j.wg.Wait()
+	assert.True(t, j.due())
+}
+
+func TestJob_RunKeepsLockOnTransientRefreshErrors(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 0
+
+	locker := &failingLocker{refreshErr: errors.New("connection reset")}
+	var cancelled bool
+	j := newScheduledJob("lock_refresh_error", locker, 300*time.Millisecond, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-time.After(150 * time.Millisecond):
+		}
+		return nil
+	})
+
+	j.run(TriggerSchedule)
+	j.wg.Wait()
+	assert.False(t, cancelled)
+	assert.False(t, j.due())
+
+	// The lock is given up once it has expired without being refreshed
+	j.handler = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	j.run(TriggerSchedule)
+	j.wg.Wait()
+	assert.True(t, j.due())
+}
+
+func TestOrchestrator_EnableJobLocking(t *testing.T) {
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_enable_job_locking")
+	assert.NoError(t, orc.AddJobE("TESTLOCKING", NewJob("locked", func(ctx context.Context) error { return nil }), &Schedule{}))
+
+	assert.NoError(t, orc.EnableJobLocking(lock.NewMemoryLocker(), 0))
+	assert.Equal(t, DefaultLockTTL, orc.Jobs["locked"].lockTTL)
+
+	assert.Error(t, orc.EnableJobLocking(lock.NewMemoryLocker(), time.Nanosecond))
+	assert.Error(t, orc.EnableJobLocking(lock.NewMemoryLocker(), -time.Minute))
+	assert.Equal(t, DefaultLockTTL, orc.Jobs["locked"].lockTTL)
+}
+
+func TestJob_RunTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	var handlerSpan trace.SpanContext
+
+	j := &Job{
+		Name:     "traced",
+		Status:   &SyncStatus{active: false},
+		Schedule: &Schedule{},
+		context:  context.Background(),
+		handler: func(ctx context.Context) error {
+			handlerSpan = trace.SpanContextFromContext(ctx)
+			return errors.New("dummy")
+		},
+		wg:      &sync.WaitGroup{},
+		metrics: setupMetrics("test_job_run_tracing"),
+		tracer:  provider.Tracer(tracerName),
+	}
+
+	j.run(TriggerSchedule)
+	j.wg.Wait()
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "job traced", spans[0].Name)
+	assert.Equal(t, spans[0].SpanContext.SpanID(), handlerSpan.SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Contains(t, spans[0].Attributes, attribute.String("job.name", "traced"))
+	assert.Contains(t, spans[0].Attributes, attribute.String("job.trigger", "schedule"))
+	assert.Contains(t, spans[0].Attributes, attribute.String("job.outcome", "failure"))
+	assert.Contains(t, spans[0].Attributes, attribute.Int("job.attempt", 1))
+}
+
 func TestNewOrchestrator(t *testing.T) {
-	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{})
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_new_orchestrator")
 	assert.NotNil(t, orc)
 }
 
 func TestOrchestrator_Init(t *testing.T) {
-	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{})
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_orchestrator_init")
 	orc.Init(nil)
 }
 
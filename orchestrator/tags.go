@@ -0,0 +1,146 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrJobNotFound is returned by operations on a Job that hasn't been added.
+var ErrJobNotFound = errors.New("job is not registered")
+
+// ErrJobPaused is returned by TriggerJob when the Job is paused.
+var ErrJobPaused = errors.New("job is paused")
+
+// WithTags adds tags to the Job, so it can be operated on as part of a group, e.g. all "aws" jobs.
+func (j *Job) WithTags(tags ...string) *Job {
+	j.Tags = append(j.Tags, tags...)
+	return j
+}
+
+func (j *Job) HasTag(tag string) bool {
+	for _, t := range j.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Pause stops the Job from being started by its schedule until it is resumed. Runs already in progress are not affected.
+func (j *Job) Pause() {
+	j.paused.Store(true)
+	if j.metrics != nil {
+		j.metrics.jobPaused.WithLabelValues(j.Name).Set(1)
+	}
+}
+
+func (j *Job) Resume() {
+	j.paused.Store(false)
+	if j.metrics != nil {
+		j.metrics.jobPaused.WithLabelValues(j.Name).Set(0)
+	}
+}
+
+func (j *Job) Paused() bool {
+	return j.paused.Load()
+}
+
+// JobsByTag returns the jobs with the given tag, sorted by name. An empty tag returns all jobs.
+func (o *Orchestrator) JobsByTag(tag string) []*Job {
+	jobs := []*Job{}
+	for _, job := range o.Jobs {
+		if tag == "" || job.HasTag(tag) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+func (o *Orchestrator) job(name string) (*Job, error) {
+	job, exists := o.Jobs[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	return job, nil
+}
+
+func (o *Orchestrator) PauseJob(name string) error {
+	job, err := o.job(name)
+	if err != nil {
+		return err
+	}
+	job.Pause()
+	logger.Info(fmt.Sprintf("Job %s paused", name))
+	return nil
+}
+
+func (o *Orchestrator) ResumeJob(name string) error {
+	job, err := o.job(name)
+	if err != nil {
+		return err
+	}
+	job.Resume()
+	logger.Info(fmt.Sprintf("Job %s resumed", name))
+	return nil
+}
+
+// TriggerJob starts the Job right away, regardless of its schedule. Paused jobs aren't started, they have to be
+// resumed first.
+func (o *Orchestrator) TriggerJob(name string) error {
+	job, err := o.job(name)
+	if err != nil {
+		return err
+	}
+	if job.Paused() {
+		return fmt.Errorf("%w: %s", ErrJobPaused, name)
+	}
+	job.Run()
+	return nil
+}
+
+// PauseTag pauses all jobs with the given tag and returns the names of the affected jobs.
+func (o *Orchestrator) PauseTag(tag string) []string {
+	return o.forTag(tag, func(job *Job) bool {
+		job.Pause()
+		return true
+	})
+}
+
+// ResumeTag resumes all jobs with the given tag and returns the names of the affected jobs.
+func (o *Orchestrator) ResumeTag(tag string) []string {
+	return o.forTag(tag, func(job *Job) bool {
+		job.Resume()
+		return true
+	})
+}
+
+// TriggerTag starts all jobs with the given tag right away and returns the names of the affected jobs. Like
+// TriggerJob, paused jobs aren't started.
+func (o *Orchestrator) TriggerTag(tag string) []string {
+	return o.forTag(tag, func(job *Job) bool {
+		if job.Paused() {
+			return false
+		}
+		job.Run()
+		return true
+	})
+}
+
+// forTag calls f for all jobs with the given tag and returns the names of the jobs f reports as affected.
+func (o *Orchestrator) forTag(tag string, f func(job *Job) bool) []string {
+	names := []string{}
+	if tag == "" {
+		return names
+	}
+	for _, job := range o.JobsByTag(tag) {
+		if f(job) {
+			names = append(names, job.Name)
+		}
+	}
+	logger.Info(fmt.Sprintf("Jobs with tag %s affected: %v", tag, names))
+	return names
+}
@@ -0,0 +1,46 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrchestrator_TagOperations(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	orc := NewOrchestrator(context.Background(), wg, "test_tag_operations")
+	runs := map[string]int{}
+	mu := sync.Mutex{}
+	handler := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			runs[name]++
+			mu.Unlock()
+			return nil
+		}
+	}
+	orc.AddJob("TESTTAGS", NewJob("ec2", handler("ec2")).WithTags("aws", "write"), &Schedule{})
+	orc.AddJob("TESTTAGS", NewJob("s3", handler("s3")).WithTags("aws"), &Schedule{})
+	orc.AddJob("TESTTAGS", NewJob("report", handler("report")), &Schedule{})
+
+	assert.Len(t, orc.JobsByTag(""), 3)
+	assert.Equal(t, []string{"ec2", "s3"}, orc.PauseTag("aws"))
+	assert.True(t, orc.Jobs["ec2"].Paused())
+	assert.True(t, orc.Jobs["s3"].Paused())
+	assert.False(t, orc.Jobs["report"].Paused())
+
+	assert.Equal(t, []string{"ec2"}, orc.ResumeTag("write"))
+	assert.False(t, orc.Jobs["ec2"].Paused())
+
+	// Paused jobs are neither triggered by tag nor by name
+	assert.Equal(t, []string{"ec2"}, orc.TriggerTag("aws"))
+	assert.ErrorIs(t, orc.TriggerJob("s3"), ErrJobPaused)
+	wg.Wait()
+	assert.Equal(t, map[string]int{"ec2": 1}, runs)
+
+	assert.ErrorIs(t, orc.PauseJob("missing"), ErrJobNotFound)
+	assert.NoError(t, orc.PauseJob("report"))
+	assert.True(t, orc.Jobs["report"].Paused())
+}
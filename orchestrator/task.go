@@ -0,0 +1,265 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Task is a one-off job that runs once at a given point in time.
+type Task struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	At      time.Time `json:"at"`
+	handler func(ctx context.Context) error
+}
+
+// TaskStore persists pending tasks so they survive a restart.
+type TaskStore interface {
+	Save(task *Task) error
+	Delete(id string) error
+	List() ([]*Task, error)
+}
+
+// RegisterTaskHandler registers a handler for tasks with the given name. Handlers are required for
+// tasks restored from a TaskStore, since a handler itself can't be persisted.
+func (o *Orchestrator) RegisterTaskHandler(name string, handler func(ctx context.Context) error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.taskHandlers[name] = handler
+}
+
+// EnableTaskPersistence stores pending tasks in store and restores the tasks already in it.
+// Stored tasks are only restored if a handler for them has been registered with RegisterTaskHandler. Tasks
+// without a handler can never be run, so they are removed from store.
+func (o *Orchestrator) EnableTaskPersistence(store TaskStore) error {
+	tasks, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.taskStore = store
+	for _, task := range tasks {
+		handler, exists := o.taskHandlers[task.Name]
+		if !exists {
+			logger.Error("No handler registered for stored task, removing it", zap.String("taskName", task.Name), zap.String("taskId", task.Id), zap.Time("at", task.At))
+			if err := store.Delete(task.Id); err != nil {
+				logger.Error("Unable to delete task from store", zap.String("taskId", task.Id), zap.Error(err))
+			}
+			continue
+		}
+		task.handler = handler
+		o.tasks[task.Id] = task
+	}
+
+	return nil
+}
+
+// ScheduleOnce schedules handler to run once at the given time. If handler is nil, the handler registered
+// for name with RegisterTaskHandler is used.
+func (o *Orchestrator) ScheduleOnce(name string, at time.Time, handler func(ctx context.Context) error) (*Task, error) {
+	o.mu.Lock()
+	if handler == nil {
+		handler = o.taskHandlers[name]
+	}
+	store := o.taskStore
+	o.mu.Unlock()
+
+	if handler == nil {
+		return nil, errors.New("no handler provided or registered for task " + name)
+	}
+
+	task := &Task{
+		Id:      newTaskId(),
+		Name:    name,
+		At:      at,
+		handler: handler,
+	}
+
+	if store != nil {
+		if err := store.Save(task); err != nil {
+			return nil, err
+		}
+	}
+
+	o.mu.Lock()
+	o.tasks[task.Id] = task
+	o.mu.Unlock()
+	logger.Info("Task scheduled", zap.String("taskName", task.Name), zap.String("taskId", task.Id), zap.Time("at", task.At))
+
+	return task, nil
+}
+
+// RunAfter schedules handler to run once after delay has passed.
+func (o *Orchestrator) RunAfter(name string, delay time.Duration, handler func(ctx context.Context) error) (*Task, error) {
+	return o.ScheduleOnce(name, time.Now().Add(delay), handler)
+}
+
+// CancelTask removes a pending task. Returns false if the task doesn't exist or has already been started.
+func (o *Orchestrator) CancelTask(id string) bool {
+	o.mu.Lock()
+	_, exists := o.tasks[id]
+	delete(o.tasks, id)
+	store := o.taskStore
+	o.mu.Unlock()
+
+	if exists && store != nil {
+		if err := store.Delete(id); err != nil {
+			logger.Error("Unable to delete task from store", zap.String("taskId", id), zap.Error(err))
+		}
+	}
+
+	return exists
+}
+
+// PendingTasks returns the tasks that have yet to be started.
+func (o *Orchestrator) PendingTasks() []*Task {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tasks := make([]*Task, 0, len(o.tasks))
+	for _, task := range o.tasks {
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func (o *Orchestrator) runDueTasks() {
+	now := time.Now()
+	var due []*Task
+
+	o.mu.Lock()
+	for id, task := range o.tasks {
+		if !task.At.After(now) {
+			due = append(due, task)
+			delete(o.tasks, id)
+		}
+	}
+	store := o.taskStore
+	o.mu.Unlock()
+
+	for _, task := range due {
+		task := task
+		job := &Job{
+			Name:    task.Name,
+			Status:  &SyncStatus{active: false},
+			context: o.ctx,
+			wg:      o.wg,
+			metrics: o.metrics,
+			tracer:  o.tracer,
+			handler: func(ctx context.Context) error {
+				err := task.handler(ctx)
+				// A task interrupted by a shutdown is kept in store, so it is run again after a restart
+				if store != nil && ctx.Err() == nil {
+					if deleteErr := store.Delete(task.Id); deleteErr != nil {
+						logger.Error("Unable to delete task from store", zap.String("taskId", task.Id), zap.Error(deleteErr))
+					}
+				}
+				return err
+			},
+		}
+		job.run(TriggerTask)
+	}
+}
+
+func newTaskId() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err) // ideally this should never happen
+	}
+	return hex.EncodeToString(buf)
+}
+
+// FileTaskStore is a TaskStore that keeps pending tasks in a JSON file.
+type FileTaskStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileTaskStore(path string) *FileTaskStore {
+	return &FileTaskStore{path: path}
+}
+
+func (s *FileTaskStore) Save(task *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks, err := s.read()
+	if err != nil {
+		return err
+	}
+	tasks[task.Id] = task
+
+	return s.write(tasks)
+}
+
+func (s *FileTaskStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks, err := s.read()
+	if err != nil {
+		return err
+	}
+	delete(tasks, id)
+
+	return s.write(tasks)
+}
+
+func (s *FileTaskStore) List() ([]*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		payload = append(payload, task)
+	}
+
+	return payload, nil
+}
+
+func (s *FileTaskStore) read() (map[string]*Task, error) {
+	tasks := map[string]*Task{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tasks, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+func (s *FileTaskStore) write(tasks map[string]*Task) error {
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,116 @@
+package orchestrator
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrchestrator_RunAfter(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	orc := NewOrchestrator(context.Background(), wg, "test_run_after")
+
+	var runs int32
+	handler := func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+
+	_, err := orc.RunAfter("now", 0, handler)
+	assert.NoError(t, err)
+	_, err = orc.RunAfter("later", time.Hour, handler)
+	assert.NoError(t, err)
+
+	orc.runDueTasks()
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	assert.Len(t, orc.PendingTasks(), 1)
+}
+
+func TestOrchestrator_ScheduleOnceWithoutHandler(t *testing.T) {
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_schedule_once_without_handler")
+
+	_, err := orc.ScheduleOnce("missing", time.Now(), nil)
+	assert.Error(t, err)
+}
+
+func TestOrchestrator_CancelTask(t *testing.T) {
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_cancel_task")
+
+	task, err := orc.RunAfter("cancel", time.Hour, func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	assert.True(t, orc.CancelTask(task.Id))
+	assert.False(t, orc.CancelTask(task.Id))
+	assert.Empty(t, orc.PendingTasks())
+}
+
+func TestOrchestrator_EnableTaskPersistence(t *testing.T) {
+	store := NewFileTaskStore(filepath.Join(t.TempDir(), "tasks.json"))
+	handler := func(ctx context.Context) error { return nil }
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_task_persistence_first")
+	orc.RegisterTaskHandler("recheck", handler)
+	assert.NoError(t, orc.EnableTaskPersistence(store))
+	_, err := orc.RunAfter("recheck", time.Hour, nil)
+	assert.NoError(t, err)
+
+	// Simulate a restart
+	wg := &sync.WaitGroup{}
+	restarted := NewOrchestrator(context.Background(), wg, "test_task_persistence_second")
+	restarted.RegisterTaskHandler("recheck", handler)
+	assert.NoError(t, restarted.EnableTaskPersistence(store))
+	pending := restarted.PendingTasks()
+	assert.Len(t, pending, 1)
+
+	pending[0].At = time.Now()
+	restarted.runDueTasks()
+	wg.Wait()
+
+	stored, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+func TestOrchestrator_TaskInterruptedByShutdownIsKept(t *testing.T) {
+	store := NewFileTaskStore(filepath.Join(t.TempDir(), "tasks.json"))
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+
+	orc := NewOrchestrator(ctx, wg, "test_task_interrupted")
+	orc.RegisterTaskHandler("recheck", func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, orc.EnableTaskPersistence(store))
+	task, err := orc.RunAfter("recheck", 0, nil)
+	assert.NoError(t, err)
+
+	orc.runDueTasks()
+	wg.Wait()
+
+	stored, err := store.List()
+	assert.NoError(t, err)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, task.Id, stored[0].Id)
+	}
+}
+
+func TestOrchestrator_EnableTaskPersistenceWithoutHandler(t *testing.T) {
+	store := NewFileTaskStore(filepath.Join(t.TempDir(), "tasks.json"))
+	assert.NoError(t, store.Save(&Task{Id: "orphan", Name: "removed", At: time.Now()}))
+
+	orc := NewOrchestrator(context.Background(), &sync.WaitGroup{}, "test_task_persistence_without_handler")
+	assert.NoError(t, orc.EnableTaskPersistence(store))
+	assert.Empty(t, orc.PendingTasks())
+
+	stored, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "go.dfds.cloud/orchestrator"
+
+// Trigger describes what caused a Job to run.
+type Trigger string
+
+const (
+	TriggerSchedule Trigger = "schedule"
+	TriggerManual   Trigger = "manual"
+	TriggerTask     Trigger = "task"
+)
+
+// SetTracerProvider sets the TracerProvider used to trace job runs. The global TracerProvider is used by default.
+func (o *Orchestrator) SetTracerProvider(provider trace.TracerProvider) {
+	o.tracer = provider.Tracer(tracerName)
+	for _, job := range o.Jobs {
+		job.tracer = o.tracer
+	}
+}
+
+// startSpan starts the span of a single Job run. The context of the span is the one passed to the handler.
+func (j *Job) startSpan(trigger Trigger) (context.Context, trace.Span) {
+	tracer := j.tracer
+	if tracer == nil {
+		tracer = otel.Tracer(tracerName)
+	}
+
+	return tracer.Start(j.context, "job "+j.Name, trace.WithAttributes(
+		attribute.String("job.name", j.Name),
+		attribute.String("job.trigger", string(trigger)),
+	))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetAttributes(attribute.String("job.outcome", "failure"))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.String("job.outcome", "success"))
+		span.SetStatus(codes.Ok, "")
+	}
+}